@@ -1,20 +1,36 @@
 package bStubs
 
-var BTurnHandler = "GolOperations.CalculateNextWorld"
+import "uk.ac.bris.cs/gameoflife/util"
+
+var BInitHandler = "GolOperations.Init"
+var BStepHandler = "GolOperations.Step"
+var BHaloHandler = "GolOperations.Halo"
+var BStripHandler = "GolOperations.Strip"
 var BShutHandler = "GolOperations.ShutServer"
 
 type Response struct {
-	Turns      int
-	World      [][]byte
+	Turns int
+	// Rows of a strip or of halos, packed one bit per cell
+	World      []util.BitRow
 	AliveCells int
+	// Cells that changed state in the step, in world coordinates, when the broker asked for them
+	Flipped []util.Cell
 }
 
 type Request struct {
-	World  [][]byte
-	Width  int
-	StartY int
-	EndY   int
-	Height int
-	Turns  int
-	Kill   bool
+	World    []util.BitRow
+	Width    int
+	StartY   int
+	EndY     int
+	Height   int
+	Turns    int
+	Kill     bool
+	Rule     string
+	Topology util.Topology
+	// Addresses of every worker server, in order of the strips they own, so that servers can exchange halos
+	Workers []string
+	// Rows of the world requested as halos by another server
+	Rows []int
+	// Whether a step should also return the cells that flipped, only asked for while a controller is watching
+	Diff bool
 }
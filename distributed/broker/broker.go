@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"math"
@@ -8,122 +10,944 @@ import (
 	"net"
 	"net/rpc"
 	"os"
+	"strings"
 	"sync"
 	"time"
 	"uk.ac.bris.cs/gameoflife/bStubs"
 	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
 )
 
-const alive = 255
-
-var aliveCount int
-var globalTurns int
 var mu sync.Mutex
-var globalWorld [][]byte
+
+// Connections to the worker servers and their addresses, in the same order
+// Both are only ever appended to or copied, so a world split between them keeps its own slices
 var workers []*rpc.Client
+var addresses []string
+
+// Held while a new world is handed to the workers, so that only one controller takes over at a time
+var startMu sync.Mutex
+
+// Signalled when a worker registers, so that the running world can be split between more workers at the end of a turn
+var joined = make(chan struct{}, 1)
+
+// How long to wait for a worker to answer before treating it as failed, and how often to keep a copy of the world
+var callTimeout time.Duration
+var checkpointTurns int
+
+// File the broker saves the running session to, so that a restarted broker can carry on with -resume, and how often
+var saveFile string
+var saveEvery time.Duration
+
+// Number of times in a row a turn may fail before the broker gives up on the world
+const maxFailures = 3
+
+// Number of turns of diffs kept for a controller before it is treated as fallen behind, how long a request for diffs waits
+// for a turn, and how long a controller can go without asking for diffs before its subscription is dropped
+const diffBuffer = 256
+const diffWait = time.Second
+const subscriberTimeout = 30 * time.Second
 
 // Gol Logic
 
-// RPC call to workers to calculate next state, response world passed into out channel
-func makeCallWorld(client *rpc.Client, world [][]byte, ImageHeight, ImageWidth, StartY, EndY, Turns int, out chan [][]byte) {
-	request := bStubs.Request{world, ImageWidth, StartY, EndY, ImageHeight, Turns, false}
+// Makes an RPC call to a worker, giving up if it doesn't answer within the timeout
+func callWorker(client *rpc.Client, method string, request bStubs.Request, response *bStubs.Response) error {
+	call := client.Go(method, request, response, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-time.After(callTimeout):
+		return fmt.Errorf("%s timed out after %v", method, callTimeout)
+	}
+}
+
+// Errors returned by a worker itself mean it is still running, any other error means it crashed or timed out
+func workerFailed(err error) bool {
+	_, ok := err.(rpc.ServerError)
+	return err != nil && !ok
+}
+
+// RPC call to give a worker its strip of the world and the addresses of the other workers it exchanges halos with
+func makeCallInit(client *rpc.Client, req stubs.Request, StartY, EndY, turn int, workerAddresses []string) error {
+	request := bStubs.Request{
+		World:    req.World.Rows[StartY:EndY],
+		Width:    req.Width,
+		StartY:   StartY,
+		EndY:     EndY,
+		Height:   req.Height,
+		Turns:    turn,
+		Rule:     req.Rule,
+		Topology: req.Topology,
+		Workers:  workerAddresses,
+	}
 	response := new(bStubs.Response)
-	client.Call(bStubs.BTurnHandler, request, response)
-	out <- response.World
-	return
+	return callWorker(client, bStubs.BInitHandler, request, response)
+}
+
+// RPC call to workers to calculate the next state of their strip, returns the number of alive cells in it
+// and the cells that flipped if diff is set
+func makeCallStep(client *rpc.Client, diff bool) (int, []util.Cell, error) {
+	response := new(bStubs.Response)
+	err := callWorker(client, bStubs.BStepHandler, bStubs.Request{Diff: diff}, response)
+	if err != nil {
+		return 0, nil, err
+	}
+	return response.AliveCells, response.Flipped, nil
+}
+
+// RPC call to workers to fetch their current strip
+func makeCallStrip(client *rpc.Client) ([]util.BitRow, error) {
+	response := new(bStubs.Response)
+	err := callWorker(client, bStubs.BStripHandler, bStubs.Request{}, response)
+	if err != nil {
+		return nil, err
+	}
+	return response.World, nil
 }
 
 // RPC call to shut down workers
-func closeServers(client *rpc.Client, world [][]byte, ImageWidth, ImageHeight, Turns int) {
-	request := bStubs.Request{world, ImageWidth, 0, 0, ImageHeight, Turns, true}
+func closeServers(client *rpc.Client, ImageWidth, ImageHeight, Turns int) {
+	request := bStubs.Request{Width: ImageWidth, StartY: 0, EndY: 0, Height: ImageHeight, Turns: Turns, Kill: true}
 	response := new(bStubs.Response)
 	client.Call(bStubs.BShutHandler, request, response)
 	return
 }
 
-// Function to split to multiple nodes based on the number of threads on input, with a maximum of 8 nodes
-func splitWorkers(req stubs.Request, world [][]byte, workers []*rpc.Client) [][]byte {
-	maximum := int(math.Min(8, float64(req.Threads)))
+// Function to split the world between as many workers as there are threads on input, at most one per worker node
+// Each worker keeps its strip between turns and exchanges halos with its neighbours directly
+// Workers that crashed or timed out are returned as failed
+func splitWorkers(req stubs.Request, turn int) (used, failed []*rpc.Client, err error) {
+	mu.Lock()
+	available := workers
+	availableAddresses := addresses
+	mu.Unlock()
+	if len(available) == 0 {
+		return nil, nil, errors.New("no worker servers have been registered with the broker")
+	}
 
-	// Initialises the out channels
-	out := make([]chan [][]byte, maximum)
-	for i := range out {
-		out[i] = make(chan [][]byte)
+	maximum := int(math.Min(math.Min(float64(len(available)), float64(req.Threads)), float64(req.Height)))
+	if maximum < 1 {
+		maximum = 1
 	}
+	used = available[:maximum]
+	usedAddresses := availableAddresses[:maximum]
 
-	// Run all worker nodes in parallel
 	for j := 0; j < maximum; j++ {
-		go makeCallWorld(workers[j], world, req.Height, req.Width, j*len(world)/maximum, (j+1)*(len(world))/maximum, req.Turns, out[j])
+		err := makeCallInit(used[j], req, j*req.Height/maximum, (j+1)*req.Height/maximum, turn, usedAddresses)
+		if workerFailed(err) {
+			failed = append(failed, used[j])
+		}
+		if err != nil {
+			return nil, failed, err
+		}
+	}
+	return used, nil, nil
+}
+
+// Runs one turn on all worker nodes in parallel and returns the number of alive cells in the new world,
+// along with the cells that flipped if diff is set
+func stepWorkers(used []*rpc.Client, diff bool) (int, []util.Cell, []*rpc.Client, error) {
+	aliveCounts := make([]int, len(used))
+	flips := make([][]util.Cell, len(used))
+	errs := make([]error, len(used))
+	var wg sync.WaitGroup
+	for i, worker := range used {
+		wg.Add(1)
+		go func(i int, worker *rpc.Client) {
+			defer wg.Done()
+			aliveCounts[i], flips[i], errs[i] = makeCallStep(worker, diff)
+		}(i, worker)
 	}
+	wg.Wait()
 
-	// Outputs new world slices into newPixelData and returns the new world
-	var newPixelData [][]byte
-	for i := 0; i < len(out); i++ {
-		newPixelData = append(newPixelData, <-out[i]...)
+	numAliveCount := 0
+	var flipped []util.Cell
+	for i, count := range aliveCounts {
+		numAliveCount += count
+		flipped = append(flipped, flips[i]...)
 	}
-	return newPixelData
+	failed, err := failedWorkers(used, errs)
+	return numAliveCount, flipped, failed, err
+}
+
+// Fetches the strips from all worker nodes in parallel and puts them together into the world
+func gatherWorld(used []*rpc.Client, width, height int) (util.BitGrid, []*rpc.Client, error) {
+	strips := make([][]util.BitRow, len(used))
+	errs := make([]error, len(used))
+	var wg sync.WaitGroup
+	for i, worker := range used {
+		wg.Add(1)
+		go func(i int, worker *rpc.Client) {
+			defer wg.Done()
+			strips[i], errs[i] = makeCallStrip(worker)
+		}(i, worker)
+	}
+	wg.Wait()
+
+	// Puts the strips together into the world and returns it
+	world := util.BitGrid{Width: width, Height: height}
+	for _, strip := range strips {
+		world.Rows = append(world.Rows, strip...)
+	}
+	failed, err := failedWorkers(used, errs)
+	return world, failed, err
+}
+
+// Picks out the workers that crashed or timed out, along with the first error from any worker
+func failedWorkers(used []*rpc.Client, errs []error) ([]*rpc.Client, error) {
+	var failed []*rpc.Client
+	var firstErr error
+	for i, err := range errs {
+		if workerFailed(err) {
+			failed = append(failed, used[i])
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return failed, firstErr
+}
+
+// Dials a worker server and adds it to the workers used for the next world
+// A worker that registers again, e.g. after a restart, replaces its old connection
+func addWorker(address string) error {
+	client, err := rpc.Dial("tcp", address)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range addresses {
+		if addresses[i] == address {
+			workers[i].Close()
+			// Copy so that a world already split between the old workers is not changed underneath it
+			workers = append([]*rpc.Client(nil), workers...)
+			workers[i] = client
+			return nil
+		}
+	}
+	workers = append(workers, client)
+	addresses = append(addresses, address)
+	// Let a running world know that it can be split between more workers
+	select {
+	case joined <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Removes a worker that crashed or timed out, so that it isn't given any more of the world
+func removeWorker(client *rpc.Client) {
+	mu.Lock()
+	defer mu.Unlock()
+	var newWorkers []*rpc.Client
+	var newAddresses []string
+	for i := range workers {
+		if workers[i] == client {
+			fmt.Println("Removing failed worker", addresses[i])
+			continue
+		}
+		newWorkers = append(newWorkers, workers[i])
+		newAddresses = append(newAddresses, addresses[i])
+	}
+	workers = newWorkers
+	addresses = newAddresses
+	client.Close()
+}
+
+// Reads the addresses of worker servers from a file, one per line, ignoring blank lines and # comments
+func readWorkers(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var list []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list = append(list, line)
+	}
+	return list, scanner.Err()
 }
 
 // Broker Struct for distributor/client to interact with broker through stubs
 type Broker struct{}
 
-// Calculate number of alive cells in 2d slice/world and returns slice of type cells containing coordinates
-func calculateAliveCells(world [][]byte) int {
-	aliveCells := 0
-	for i := 0; i < len(world); i++ {
-		for j := 0; j < len(world[i]); j++ {
-			if world[i][j] == alive {
-				aliveCells++
+// A world owned by the broker, which keeps running whether or not a controller is attached to it
+// The turn loop keeps the workers it is split between and the last checkpoint, which is gone back to when a worker fails
+type session struct {
+	id  string
+	req stubs.Request
+	err error
+
+	used           []*rpc.Client
+	turn           int
+	checkpoint     util.BitGrid
+	checkpointTurn int
+	failures       int
+	saved          time.Time
+
+	// Progress shown to controllers, guarded by mu
+	aliveCount     int
+	completedTurns int
+	attached       int
+
+	// Snapshot requests are answered by the turn loop between turns, so that every strip is from the same turn
+	snapshots chan chan stubs.Response
+	// Pause and resume requests, also answered between turns with the turn the world is on
+	pauses  chan chan int
+	resumes chan chan int
+	paused  bool
+	// Edit requests, which are only made while paused
+	edits chan editRequest
+	// Controllers watching the session, which are sent the cells that flip every turn, guarded by mu
+	subscribers map[int]*subscriber
+	// Closed to ask the turn loop to return at the end of its turn, as a new world has been started
+	stop chan struct{}
+	// Closed when the turn loop finishes, after which the checkpoint is the final world
+	finished chan struct{}
+}
+
+// A request to edit the world of a session, answered with whether it was made
+type editRequest struct {
+	edit  util.Edit
+	reply chan error
+}
+
+// A controller watching a session, whose diffs are dropped rather than holding up the workers if it falls behind
+type subscriber struct {
+	diffs  chan stubs.Diff
+	missed bool
+	polled time.Time
+}
+
+// The session the workers are running, or the last one if it has finished
+var current *session
+
+// Id of the last subscription, guarded by mu
+var lastSubscriber int
+
+// Finds the session with the given id, or the current session if no id is given
+func lookupSession(id string) (*session, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil || id != "" && current.id != id {
+		return nil, fmt.Errorf("no session %q on this broker", id)
+	}
+	return current, nil
+}
+
+// Creates a session for the world in req, with a random id for controllers to attach with unless req gives one
+func newSession(req stubs.Request) *session {
+	world := req.World
+	req.World = util.BitGrid{}
+	id := req.Session
+	if id == "" {
+		id = fmt.Sprintf("%08x", rand.Uint32())
+	}
+	return &session{
+		id:             id,
+		req:            req,
+		checkpoint:     world,
+		checkpointTurn: req.CompletedTurns,
+		turn:           req.CompletedTurns,
+		saved:          time.Now(),
+		aliveCount:     world.Count(),
+		completedTurns: req.CompletedTurns,
+		attached:       1,
+		subscribers:    make(map[int]*subscriber),
+		snapshots:      make(chan chan stubs.Response),
+		pauses:         make(chan chan int),
+		resumes:        make(chan chan int),
+		edits:          make(chan editRequest),
+		stop:           make(chan struct{}),
+		finished:       make(chan struct{}),
+	}
+}
+
+// Splits the checkpoint between the workers, which carry on from the checkpoint's turn
+func (s *session) split() ([]*rpc.Client, error) {
+	req := s.req
+	req.World = s.checkpoint
+	used, failed, err := splitWorkers(req, s.checkpointTurn)
+	if err != nil {
+		return failed, err
+	}
+	s.used = used
+	s.turn = s.checkpointTurn
+	return nil, nil
+}
+
+// Removes the workers that failed and splits the last checkpoint between the workers that are left
+func (s *session) recover(failed []*rpc.Client, cause error) error {
+	for {
+		s.failures++
+		if s.failures > maxFailures {
+			return cause
+		}
+		fmt.Println("Going back to turn", s.checkpointTurn, "after error:", cause)
+		for _, worker := range failed {
+			removeWorker(worker)
+		}
+		mu.Lock()
+		s.aliveCount = s.checkpoint.Count()
+		s.completedTurns = s.checkpointTurn
+		mu.Unlock()
+
+		failed, cause = s.split()
+		if cause == nil {
+			return nil
+		}
+	}
+}
+
+// Fetches the world from the workers and keeps it as the checkpoint
+// If a worker fails, the session goes back to the last checkpoint instead, either way the checkpoint is the world at s.turn
+func (s *session) gather() error {
+	world, failed, err := gatherWorld(s.used, s.req.Width, s.req.Height)
+	if err != nil {
+		return s.recover(failed, err)
+	}
+	s.checkpoint = world
+	s.checkpointTurn = s.turn
+	if time.Since(s.saved) >= saveEvery {
+		s.save()
+	}
+	return nil
+}
+
+// Writes the checkpoint to the save file, a broker that can't save carries on running the world
+func (s *session) save() {
+	if saveFile == "" {
+		return
+	}
+	s.saved = time.Now()
+	err := util.WriteCheckpoint(saveFile, util.Checkpoint{
+		CompletedTurns: s.checkpointTurn,
+		Turns:          s.req.Turns,
+		Threads:        s.req.Threads,
+		ImageWidth:     s.req.Width,
+		ImageHeight:    s.req.Height,
+		Rule:           s.req.Rule,
+		Topology:       s.req.Topology,
+		Session:        s.id,
+		World:          s.checkpoint,
+	})
+	if err != nil {
+		fmt.Println("Could not save session", s.id, "to", saveFile+":", err)
+	}
+}
+
+// Splits the world between more workers if some have registered since it was last split
+func (s *session) grow() error {
+	mu.Lock()
+	available := len(workers)
+	mu.Unlock()
+	if available <= len(s.used) || len(s.used) >= s.req.Threads || len(s.used) >= s.req.Height {
+		return nil
+	}
+	err := s.gather()
+	if err != nil {
+		return err
+	}
+	fmt.Println("Splitting turn", s.turn, "between more workers")
+	failed, err := s.split()
+	if err != nil {
+		return s.recover(failed, err)
+	}
+	return nil
+}
+
+// Sends the world as it is now to a snapshot request
+func (s *session) snapshot(reply chan stubs.Response) error {
+	err := s.gather()
+	reply <- stubs.Response{Turns: s.turn, World: s.checkpoint, AliveCells: s.checkpoint.Count()}
+	return err
+}
+
+// Holds the turn loop between turns until the session is resumed, still answering snapshot requests
+// Returns true if the session was stopped while paused
+func (s *session) waitPaused(reply chan int) bool {
+	s.setPaused(true)
+	reply <- s.turn
+	fmt.Println("Session", s.id, "paused on turn", s.turn)
+
+	for {
+		select {
+		case reply := <-s.snapshots:
+			err := s.snapshot(reply)
+			if err != nil {
+				fmt.Println("Snapshot while paused failed:", err)
 			}
+		// Already paused
+		case reply := <-s.pauses:
+			reply <- s.turn
+		case request := <-s.edits:
+			request.reply <- s.edit(request.edit)
+		case reply := <-s.resumes:
+			s.setPaused(false)
+			reply <- s.turn
+			fmt.Println("Session", s.id, "resumed on turn", s.turn)
+			return false
+		case <-s.stop:
+			s.setPaused(false)
+			return true
 		}
 	}
-	return aliveCells
 }
 
-// Receives RPC call from client/distributor that splits the workers and returns the udpated world, repeats this 100 turns
-func (s *Broker) CalculateNextWorld(req stubs.Request, res *stubs.Response) (err error) {
-	turn := 0
-	globalWorld = req.World
-	// Runs for at most 100 turns to update the world
-	for turn < req.Turns {
-		// splitWorkers returns new world state
+// Edits the world while paused, by fetching it from the workers, changing it and splitting it between them again
+// The cells that change are published as a diff of the turn the world is on, for the controllers watching to change too
+func (s *session) edit(edit util.Edit) error {
+	err := s.gather()
+	if err != nil {
+		return err
+	}
+	world := s.checkpoint.Copy()
+	var changed util.Edit
+	for _, cell := range world.Changes(edit) {
+		world.Rows[cell.Y].Flip(cell.X)
+		if world.Rows[cell.Y].Get(cell.X) {
+			changed.Alive = append(changed.Alive, cell)
+		} else {
+			changed.Dead = append(changed.Dead, cell)
+		}
+	}
+	if len(changed.Alive)+len(changed.Dead) == 0 {
+		return nil
+	}
+	s.checkpoint = world
+	failed, err := s.split()
+	if err != nil {
+		err = s.recover(failed, err)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println("Session", s.id, "edited on turn", s.turn)
+
+	mu.Lock()
+	s.aliveCount = world.Count()
+	s.publish(stubs.Diff{Turn: s.turn, Edit: &changed})
+	mu.Unlock()
+	return nil
+}
+
+// Adds a subscription to the diffs of every turn from now on, only called while holding mu
+func (s *session) subscribe(id int) {
+	s.subscribers[id] = &subscriber{diffs: make(chan stubs.Diff, diffBuffer), polled: time.Now()}
+}
+
+// Sends the cells that flipped in a turn to every subscriber, only called while holding mu
+// A subscriber whose diffs are full has them dropped, and catches up from a snapshot instead
+func (s *session) publish(diff stubs.Diff) {
+	for id, sub := range s.subscribers {
+		if time.Since(sub.polled) > subscriberTimeout {
+			fmt.Println("Dropping subscription", id, "to session", s.id)
+			delete(s.subscribers, id)
+			continue
+		}
+		select {
+		case sub.diffs <- diff:
+		default:
+			sub.missed = true
+			takeDiffs(sub)
+			sub.diffs <- diff
+		}
+	}
+}
+
+// Records whether the session is paused, for controllers checking on it
+func (s *session) setPaused(paused bool) {
+	mu.Lock()
+	s.paused = paused
+	mu.Unlock()
+}
+
+// Asks the turn loop to stop and waits for it to return, only called while holding startMu
+func (s *session) halt() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.finished
+}
+
+// Turn loop of the session, which runs for the given number of turns unless a new world is started
+// Only the halos move between workers, the whole world is only fetched for checkpoints and snapshots
+func (s *session) run() {
+	defer close(s.finished)
+	defer func() {
+		if s.err != nil {
+			fmt.Println("Session", s.id, "failed:", s.err)
+		} else {
+			s.save()
+		}
+	}()
+
+	for {
+		if s.turn >= s.req.Turns {
+			// Fetch the final world, if a worker fails on the way the last turns are run again
+			s.err = s.gather()
+			if s.err != nil || s.turn >= s.req.Turns {
+				return
+			}
+			continue
+		}
+
+		// Workers only send the cells that flipped while a controller is watching
 		mu.Lock()
-		globalWorld = splitWorkers(req, globalWorld, workers)
+		diff := len(s.subscribers) > 0
 		mu.Unlock()
-		// counts number of alive cells in update world
-		numAliveCount := calculateAliveCells(globalWorld)
+		numAliveCount, flipped, failed, err := stepWorkers(s.used, diff)
+		if err != nil {
+			s.err = s.recover(failed, err)
+			if s.err != nil {
+				return
+			}
+			continue
+		}
+		s.turn++
+		s.failures = 0
 
 		mu.Lock()
-		aliveCount = numAliveCount
+		s.aliveCount = numAliveCount
+		s.completedTurns = s.turn
+		if diff {
+			s.publish(stubs.Diff{Turn: s.turn, Flipped: flipped})
+		}
 		mu.Unlock()
 
-		turn++
+		// Keep a recent copy of the world, so that little work is lost when a worker fails
+		if s.turn-s.checkpointTurn >= checkpointTurns {
+			s.err = s.gather()
+			if s.err != nil {
+				return
+			}
+		}
+
+		// Answer snapshot requests and take on new workers between turns, when every worker is on the same turn
+		select {
+		case reply := <-s.snapshots:
+			s.err = s.snapshot(reply)
+			if s.err != nil {
+				return
+			}
+		case reply := <-s.pauses:
+			if s.waitPaused(reply) {
+				s.err = s.gather()
+				return
+			}
+		// Already running
+		case reply := <-s.resumes:
+			reply <- s.turn
+		case request := <-s.edits:
+			request.reply <- fmt.Errorf("session %s is running, pause it to edit the world", s.id)
+		case <-joined:
+			s.err = s.grow()
+			if s.err != nil {
+				return
+			}
+		// A new world has been started, stop with the world as it is now
+		case <-s.stop:
+			s.err = s.gather()
+			return
+		default:
+		}
+	}
+}
+
+// Receives RPC call from client/distributor that hands the world to the workers and starts running it for the given number of turns
+// The world runs as a session on the broker, so the controller can detach and other controllers can attach to it using the returned id
+func (b *Broker) Start(req stubs.Request, res *stubs.Response) (err error) {
+	startMu.Lock()
+	defer startMu.Unlock()
+	sess, err := startSession(req)
+	if err != nil {
+		return err
+	}
+	// Subscribe before the first turn, so that the controller is sent every turn
+	if req.Subscribe {
 		mu.Lock()
-		globalTurns = turn
+		lastSubscriber++
+		sess.subscribe(lastSubscriber)
+		res.Subscriber = lastSubscriber
 		mu.Unlock()
 	}
-	res.Turns = turn
-	res.World = globalWorld
+	go sess.run()
+	res.Session = sess.id
 	return
 }
 
-// RPC call from client to broker to receive number of alive cells every 2s
-func (s *Broker) CalculateAlive(req stubs.Request, res *stubs.Response) (err error) {
+// Splits the world in req between the workers and makes it the current session, only called while holding startMu
+// The caller starts the turn loop
+func startSession(req stubs.Request) (*session, error) {
+	// The workers only hold one world, so stop the session that is running
 	mu.Lock()
-	res.AliveCells = aliveCount
+	previous := current
 	mu.Unlock()
+	if previous != nil {
+		previous.halt()
+	}
+
+	// Workers that registered before now are used from the start
+	select {
+	case <-joined:
+	default:
+	}
+	sess := newSession(req)
+	failed, err := sess.split()
+	if err != nil {
+		err = sess.recover(failed, err)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mu.Lock()
+	current = sess
+	mu.Unlock()
+	// Save the new world straight away, so the save file never holds a session that has been replaced
+	sess.save()
+	fmt.Println("Started session", sess.id, "on turn", sess.turn)
+
+	return sess, nil
+}
+
+// Starts the session saved in a checkpoint under the same id once a worker is available, so controllers can attach to it again
+func resumeSession(checkpoint util.Checkpoint) {
+	for {
+		mu.Lock()
+		available := len(workers)
+		mu.Unlock()
+		if available > 0 {
+			break
+		}
+		<-joined
+	}
 
+	startMu.Lock()
+	defer startMu.Unlock()
+	sess, err := startSession(stubs.Request{
+		World:          checkpoint.World,
+		Width:          checkpoint.ImageWidth,
+		Height:         checkpoint.ImageHeight,
+		Turns:          checkpoint.Turns,
+		Threads:        checkpoint.Threads,
+		Rule:           checkpoint.Rule,
+		Topology:       checkpoint.Topology,
+		Session:        checkpoint.Session,
+		CompletedTurns: checkpoint.CompletedTurns,
+	})
+	if err != nil {
+		fmt.Println("Could not resume session", checkpoint.Session+":", err)
+		return
+	}
+	// No controller is attached until one reattaches with the session id
+	mu.Lock()
+	sess.attached = 0
+	mu.Unlock()
+	go sess.run()
+}
+
+// RPC call from a controller attaching to a running session, which returns the details of its world
+// The current world and turn are then fetched with Snapshot
+func (b *Broker) Attach(req stubs.Request, res *stubs.Response) (err error) {
+	sess, err := lookupSession(req.Session)
+	if err != nil {
+		return err
+	}
 	mu.Lock()
-	res.Turns = globalTurns
+	sess.attached++
+	fmt.Println("Controller attached to session", sess.id+",", sess.attached, "attached")
 	mu.Unlock()
+
+	res.Session = sess.id
+	res.Width = sess.req.Width
+	res.Height = sess.req.Height
+	res.Turns = sess.req.Turns
+	res.Threads = sess.req.Threads
+	res.Rule = sess.req.Rule
+	res.Topology = sess.req.Topology
+	return
+}
+
+// RPC call from a controller leaving a session, which carries on running without it
+func (b *Broker) Detach(req stubs.Request, res *stubs.Response) (err error) {
+	sess, err := lookupSession(req.Session)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	if sess.attached > 0 {
+		sess.attached--
+	}
+	delete(sess.subscribers, req.Subscriber)
+	fmt.Println("Controller detached from session", sess.id+",", sess.attached, "attached")
+	mu.Unlock()
+	return
+}
+
+// RPC call from a controller that waits for a session to finish, returning the final world
+// A session stopped because a new world was started returns the world it got to
+func (b *Broker) Wait(req stubs.Request, res *stubs.Response) (err error) {
+	sess, err := lookupSession(req.Session)
+	if err != nil {
+		return err
+	}
+	<-sess.finished
+	res.Session = sess.id
+	res.Turns = sess.turn
+	res.World = sess.checkpoint
+	res.AliveCells = sess.checkpoint.Count()
+	return sess.err
+}
+
+// RPC call from a controller to hold the session at the end of the current turn, returns the turn it is paused on
+func (b *Broker) Pause(req stubs.Request, res *stubs.Response) (err error) {
+	return control(req, res, func(sess *session) chan chan int { return sess.pauses })
+}
+
+// RPC call from a controller to carry on running a paused session, returns the turn it carries on from
+func (b *Broker) Resume(req stubs.Request, res *stubs.Response) (err error) {
+	return control(req, res, func(sess *session) chan chan int { return sess.resumes })
+}
+
+// Sends a pause or resume request to the turn loop of a session and waits for the turn it was answered on
+func control(req stubs.Request, res *stubs.Response, requests func(sess *session) chan chan int) error {
+	sess, err := lookupSession(req.Session)
+	if err != nil {
+		return err
+	}
+	reply := make(chan int)
+	select {
+	case requests(sess) <- reply:
+		res.Turns = <-reply
+	// A finished session stays on its final turn
+	case <-sess.finished:
+		res.Turns = sess.turn
+	}
+	res.Session = sess.id
+	return nil
+}
+
+// RPC call from a controller to set cells of a paused session, which are sent to its subscribers as a diff
+func (b *Broker) Edit(req stubs.Request, res *stubs.Response) (err error) {
+	sess, err := lookupSession(req.Session)
+	if err != nil {
+		return err
+	}
+	request := editRequest{edit: req.Edit, reply: make(chan error)}
+	select {
+	case sess.edits <- request:
+		err = <-request.reply
+	case <-sess.finished:
+		err = fmt.Errorf("session %s has finished", sess.id)
+	}
+	res.Session = sess.id
+	return err
+}
+
+// RPC call from a controller to be sent the cells that flip every turn from now on, returns the id of the subscription
+func (b *Broker) Subscribe(req stubs.Request, res *stubs.Response) (err error) {
+	sess, err := lookupSession(req.Session)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	lastSubscriber++
+	sess.subscribe(lastSubscriber)
+	res.Subscriber = lastSubscriber
+	mu.Unlock()
+	res.Session = sess.id
+	return
+}
+
+// RPC call from a subscribed controller for the diffs of the turns since it last asked, waiting for at least one turn
+// A controller that fell behind is told it missed some turns instead, and catches up with Snapshot
+func (b *Broker) Diffs(req stubs.Request, res *stubs.Response) (err error) {
+	sess, err := lookupSession(req.Session)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	sub, ok := sess.subscribers[req.Subscriber]
+	if !ok {
+		// The subscription was dropped while the controller wasn't asking, so start it again
+		sess.subscribe(req.Subscriber)
+		sub = sess.subscribers[req.Subscriber]
+		sub.missed = true
+	}
+	sub.polled = time.Now()
+	missed := sub.missed
+	sub.missed = false
+	mu.Unlock()
+	res.Session = sess.id
+	if missed {
+		res.Missed = true
+		return
+	}
+
+	select {
+	case diff := <-sub.diffs:
+		res.Diffs = append(res.Diffs, diff)
+	// A finished or paused session has no more turns for now
+	case <-sess.finished:
+	case <-time.After(diffWait):
+	}
+	res.Diffs = append(res.Diffs, takeDiffs(sub)...)
+	return
+}
+
+// Empties the diffs waiting for a subscriber without blocking, as they may be taken by the turn loop at the same time
+func takeDiffs(sub *subscriber) []stubs.Diff {
+	var diffs []stubs.Diff
+	for {
+		select {
+		case diff := <-sub.diffs:
+			diffs = append(diffs, diff)
+		default:
+			return diffs
+		}
+	}
+}
+
+// RPC call from client to broker to receive number of alive cells every 2s
+func (b *Broker) CalculateAlive(req stubs.Request, res *stubs.Response) (err error) {
+	sess, err := lookupSession(req.Session)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	res.AliveCells = sess.aliveCount
+	res.Turns = sess.completedTurns
+	res.Paused = sess.paused
+	mu.Unlock()
+	return
+}
+
+// RPC call from a worker server announcing itself to the broker when it starts up
+func (b *Broker) Register(req stubs.Request, res *stubs.Response) (err error) {
+	err = addWorker(req.Address)
+	if err != nil {
+		fmt.Println("Could not reach registering worker", req.Address, err)
+		return
+	}
+	fmt.Println("Worker registered", req.Address)
 	return
 }
 
 // RPC call from client to broker to shut down all servers and broker
-func (s *Broker) ShutServer(req stubs.Request, res *stubs.Response) (err error) {
+func (b *Broker) ShutServer(req stubs.Request, res *stubs.Response) (err error) {
 	mu.Lock()
-	for i := 0; i < 8; i++ {
-		closeServers(workers[i], req.World, req.Width, req.Height, req.Turns)
+	for _, worker := range workers {
+		closeServers(worker, req.Width, req.Height, req.Turns)
 	}
 	mu.Unlock()
 	os.Exit(3)
@@ -131,58 +955,79 @@ func (s *Broker) ShutServer(req stubs.Request, res *stubs.Response) (err error)
 }
 
 // RPC call from client to broker to receive current world to be saved
-func (s *Broker) Snapshot(req stubs.Request, res *stubs.Response) (err error) {
-	mu.Lock()
-	res.Turns = globalTurns
-	res.World = globalWorld
-	mu.Unlock()
+func (b *Broker) Snapshot(req stubs.Request, res *stubs.Response) (err error) {
+	sess, err := lookupSession(req.Session)
+	if err != nil {
+		return err
+	}
+
+	reply := make(chan stubs.Response)
+	select {
+	// The world is being calculated, so wait for the end of the current turn
+	case sess.snapshots <- reply:
+		*res = <-reply
+	// Nothing is running, so the last world is up to date
+	case <-sess.finished:
+		res.Turns = sess.turn
+		res.World = sess.checkpoint
+		res.AliveCells = sess.checkpoint.Count()
+	}
+	res.Session = sess.id
 	return
 }
 
 // Main function to setup the broker and port to listen on
 // As well as register the Broker variable and register it
+// Worker servers are given with -workers and -config, or register themselves when started with -broker, e.g. on one machine:
+// $ go run broker/broker.go -port 8030
+// $ go run server/server.go -port 8031 -broker 127.0.0.1:8030 (and so on, for as many workers as needed)
+// Running the broker with -save broker.checkpoint lets it carry on from the same turn after a restart with -resume broker.checkpoint
 func main() {
 	pAddr := flag.String("port", "8030", "Port to listen on")
+	workerList := flag.String("workers", "", "Comma separated addresses of worker servers, e.g. 127.0.0.1:8031,127.0.0.1:8032")
+	config := flag.String("config", "", "File with the address of a worker server on each line")
+	// Keep the timeout longer than the time servers wait for halos from each other, so a slow server isn't blamed for a failed one
+	flag.DurationVar(&callTimeout, "timeout", 10*time.Second, "How long to wait for a worker before treating it as failed")
+	flag.IntVar(&checkpointTurns, "checkpoint", 50, "Number of turns between copies of the world kept to recover from failed workers")
+	flag.StringVar(&saveFile, "save", "", "File to save the running session to, so that a restarted broker can carry on with -resume")
+	flag.DurationVar(&saveEvery, "saveEvery", time.Minute, "How often to save the running session when -save is given")
+	resume := flag.String("resume", "", "Checkpoint to carry on from, saved by -save or by a controller")
 	flag.Parse()
 	rand.Seed(time.Now().UnixNano())
 	task := &Broker{}
 	rpc.Register(task)
-	listener, _ := net.Listen("tcp", ":"+*pAddr)
+	listener, err := net.Listen("tcp", ":"+*pAddr)
+	util.Check(err)
 	defer listener.Close()
 
-	workers = make([]*rpc.Client, 8)
-
-	//AWS ADDRESSES
-	address := make([]string, 8)
-	address[0] = "44.200.132.137"
-	address[1] = "44.212.47.118"
-	address[2] = "44.200.201.158"
-	address[3] = "44.197.193.0"
-	address[4] = "44.198.171.45"
-	address[5] = "3.221.127.69"
-	address[6] = "3.238.147.211"
-	address[7] = "54.236.241.48"
-
-	// AWS PORT
-	port := ":8030"
-
-	// LOCAL PORT
-	//address := "127.0.0.1"
-	//port := ":803"
-
-	// Dials into every address of the worker node
-	for i := 0; i < 8; i++ {
-		// WORKERS AWS
-		fmt.Println(address[i] + port)
-		workers[i], _ = rpc.Dial("tcp", address[i]+port)
-
-		// WORKERS LOCAL - Usage: $ go run server.go -port=8031 .. 8038
-		//fmt.Println(address + port + strconv.Itoa(i+1))
-		//workers[i], _ = rpc.Dial("tcp", address+port+strconv.Itoa(i+1))
+	var list []string
+	if *config != "" {
+		list, err = readWorkers(*config)
+		util.Check(err)
+	}
+	if *workerList != "" {
+		list = append(list, strings.Split(*workerList, ",")...)
+	}
 
-		defer workers[i].Close()
+	// Dials into every address of the worker node, skipping ones that can't be reached
+	// The workers use the same addresses to dial each other for halo exchange
+	for _, address := range list {
+		address = strings.TrimSpace(address)
+		err := addWorker(address)
+		if err != nil {
+			fmt.Println("Could not reach worker", address, err)
+			continue
+		}
+		fmt.Println(address)
 	}
 	fmt.Println("--- PORTS LOGGED")
 
+	// The session is started as soon as a worker is available, which may be one that registers later
+	if *resume != "" {
+		checkpoint, err := util.ReadCheckpoint(*resume)
+		util.Check(err)
+		go resumeSession(checkpoint)
+	}
+
 	rpc.Accept(listener)
 }
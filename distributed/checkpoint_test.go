@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestCheckpoint starts its own broker and two servers. It saves a checkpoint of a 512x512 world with c and resumes it
+// in a new session, then restarts the broker part way through a session and checks that it carries on from its save file.
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gol")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+	brokerPath := buildCommand(t, dir, "broker")
+	serverPath := buildCommand(t, dir, "server")
+
+	brokerAddr := "127.0.0.1:8070"
+	saveFile := filepath.Join(dir, "broker.checkpoint")
+	brokerArgs := []string{"-port", "8070", "-checkpoint", "10", "-save", saveFile, "-saveEvery", "0"}
+	broker := startCommand(t, "--- PORTS LOGGED", brokerPath, brokerArgs...)
+	defer func() { stopCommand(broker) }()
+	var servers []*exec.Cmd
+	defer func() {
+		for _, server := range servers {
+			stopCommand(server)
+		}
+	}()
+	for port := 8071; port <= 8072; port++ {
+		servers = append(servers, startCommand(t, "Registered", serverPath, "-port", strconv.Itoa(port), "-broker", brokerAddr))
+	}
+
+	t.Run("controller", func(t *testing.T) {
+		p := gol.Params{Turns: 100, Threads: 2, ImageWidth: 512, ImageHeight: 512, Broker: brokerAddr}
+		expectedAlive := readAliveCells(
+			"check/images/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns),
+			p.ImageWidth,
+			p.ImageHeight,
+		)
+		events := make(chan gol.Event)
+		keyPresses := make(chan rune, 1)
+		keyPresses <- 'c'
+		go gol.Run(p, events, keyPresses)
+		saved := waitForEvent(t, events, gol.CheckpointComplete{}).(gol.CheckpointComplete)
+		defer os.Remove(saved.Filename)
+		for range events {
+		}
+
+		// Only the checkpoint and the broker are given, the rest comes from the checkpoint
+		events = make(chan gol.Event)
+		go gol.Run(gol.Params{Resume: saved.Filename, Broker: brokerAddr}, events, nil)
+		final := waitForEvent(t, events, gol.FinalTurnComplete{}).(gol.FinalTurnComplete)
+		for range events {
+		}
+		if final.CompletedTurns != p.Turns {
+			t.Errorf("resumed from turn %v, expected to finish on turn %v, finished on turn %v", saved.CompletedTurns, p.Turns, final.CompletedTurns)
+		}
+		assertEqualBoard(t, final.Alive, expectedAlive, p)
+	})
+
+	t.Run("broker", func(t *testing.T) {
+		p := gol.Params{Turns: 100000000, Threads: 2, ImageWidth: 512, ImageHeight: 512, Broker: brokerAddr}
+		alive := readAliveCounts(p.ImageWidth, p.ImageHeight)
+		detachedTurn := runUntilQuit(t, p, alive)
+
+		client, err := rpc.Dial("tcp", brokerAddr)
+		util.Check(err)
+		response := new(stubs.Response)
+		util.Check(client.Call(stubs.AttachHandler, stubs.Request{}, response))
+		util.Check(client.Call(stubs.DetachHandler, stubs.Request{Session: response.Session}, new(stubs.Response)))
+		client.Close()
+
+		// The servers only register with the broker they were started with, so the new broker is given them
+		stopCommand(broker)
+		broker = startCommand(t, "Started session", brokerPath,
+			append(brokerArgs, "-resume", saveFile, "-workers", "127.0.0.1:8071,127.0.0.1:8072")...)
+
+		attachedTurn := runUntilQuit(t, gol.Params{Session: response.Session, Broker: brokerAddr}, alive)
+		if attachedTurn <= detachedTurn {
+			t.Errorf("expected the restarted broker to carry on after turn %v, but the attached controller finished on turn %v", detachedTurn, attachedTurn)
+		}
+	})
+}
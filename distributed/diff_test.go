@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestDiffs applies the CellFlipped events of a 512x512 world to a board and checks the alive cells on every TurnComplete.
+// The slow controller takes so long over each turn that the broker drops turns for it, which it should catch up from.
+func TestDiffs(t *testing.T) {
+	alive := readAliveCounts(512, 512)
+	t.Run("fast", func(t *testing.T) {
+		turns := followTurns(t, gol.Params{Turns: 100, Threads: 8, ImageWidth: 512, ImageHeight: 512}, alive, 0)
+		if turns != 100 {
+			t.Errorf("expected a TurnComplete event for each of 100 turns, got %v", turns)
+		}
+	})
+	t.Run("slow", func(t *testing.T) {
+		turns := followTurns(t, gol.Params{Turns: 1000, Threads: 8, ImageWidth: 512, ImageHeight: 512}, alive, 20*time.Millisecond)
+		if turns >= 1000 {
+			t.Errorf("expected turns to be dropped for a slow controller, got all %v", turns)
+		}
+	})
+}
+
+// Runs a world, checking the board built from CellFlipped events against the alive counts, and returns the number of turns seen
+func followTurns(t *testing.T, p gol.Params, alive map[int]int, delay time.Duration) int {
+	board := make([][]bool, p.ImageHeight)
+	for i := range board {
+		board[i] = make([]bool, p.ImageWidth)
+	}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+
+	turns := 0
+	lastTurn := 0
+	for event := range events {
+		switch e := event.(type) {
+		case gol.CellFlipped:
+			board[e.Cell.Y][e.Cell.X] = !board[e.Cell.Y][e.Cell.X]
+		case gol.TurnComplete:
+			if e.CompletedTurns <= lastTurn {
+				t.Fatalf("turn %v completed after turn %v", e.CompletedTurns, lastTurn)
+			}
+			lastTurn = e.CompletedTurns
+			turns++
+			count := 0
+			for _, row := range board {
+				for _, cell := range row {
+					if cell {
+						count++
+					}
+				}
+			}
+			if expected := expectedAlive(alive, e.CompletedTurns); count != expected {
+				t.Fatalf("At turn %v expected %v alive cells on the board, got %v instead", e.CompletedTurns, expected, count)
+			}
+			time.Sleep(delay)
+		case gol.FinalTurnComplete:
+			if lastTurn != e.CompletedTurns {
+				t.Errorf("finished on turn %v, but the last TurnComplete was for turn %v", e.CompletedTurns, lastTurn)
+			}
+		}
+	}
+	return turns
+}
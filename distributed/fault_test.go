@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestFaultTolerance starts its own broker and three servers, kills one of the servers while a 512x512 world is running,
+// starts a new one in its place and checks that the final world still matches check/images.
+func TestFaultTolerance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gol")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+	brokerPath := buildCommand(t, dir, "broker")
+	serverPath := buildCommand(t, dir, "server")
+
+	brokerAddr := "127.0.0.1:8050"
+	broker := startCommand(t, "--- PORTS LOGGED", brokerPath, "-port", "8050", "-checkpoint", "10")
+	defer stopCommand(broker)
+	var servers []*exec.Cmd
+	defer func() {
+		for _, server := range servers {
+			stopCommand(server)
+		}
+	}()
+	for port := 8051; port <= 8053; port++ {
+		servers = append(servers, startCommand(t, "Registered", serverPath, "-port", strconv.Itoa(port), "-broker", brokerAddr))
+	}
+
+	p := gol.Params{Turns: 100, Threads: 3, ImageWidth: 512, ImageHeight: 512, Broker: brokerAddr}
+	expectedAlive := readAliveCells(
+		"check/images/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns),
+		p.ImageWidth,
+		p.ImageHeight,
+	)
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+
+	// Kill the middle server once the world is part way through
+	client, err := rpc.Dial("tcp", brokerAddr)
+	util.Check(err)
+	defer client.Close()
+	for {
+		response := new(stubs.Response)
+		// The controller may not have started its session yet
+		err := client.Call(stubs.AliveHandler, stubs.Request{}, response)
+		if err == nil && response.Turns >= p.Turns {
+			t.Fatal("the world finished before a server could be killed")
+		}
+		if err == nil && response.Turns >= 20 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	stopCommand(servers[1])
+	servers = append(servers, startCommand(t, "Registered", serverPath, "-port", "8054", "-broker", brokerAddr))
+
+	var cells []util.Cell
+	for event := range events {
+		switch e := event.(type) {
+		case gol.FinalTurnComplete:
+			cells = e.Alive
+		}
+	}
+	assertEqualBoard(t, cells, expectedAlive, p)
+}
+
+// TestFaultBroker starts its own broker and a server, and kills the broker part way through a 64x64 world while s is pressed.
+// The controller should return the error from Wait instead of panicking, and quit on the turn its events got up to.
+func TestFaultBroker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gol")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+	brokerPath := buildCommand(t, dir, "broker")
+	serverPath := buildCommand(t, dir, "server")
+
+	brokerAddr := "127.0.0.1:8060"
+	broker := startCommand(t, "--- PORTS LOGGED", brokerPath, "-port", "8060")
+	defer func() { stopCommand(broker) }()
+	server := startCommand(t, "Registered", serverPath, "-port", "8061", "-broker", brokerAddr)
+	defer stopCommand(server)
+
+	p := gol.Params{Turns: 1000000000, Threads: 1, ImageWidth: 64, ImageHeight: 64, Broker: brokerAddr, Output: filepath.Join(dir, "world.pgm")}
+	simulation, err := gol.Start(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed := 0
+	var last gol.Event
+	for event := range simulation.Events {
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			completed = e.CompletedTurns
+			if completed == 10 {
+				stopCommand(broker)
+				simulation.Press('s')
+			}
+		case gol.ImageOutputComplete, gol.FinalTurnComplete:
+			t.Errorf("expected a run whose broker was killed to finish without %T", event)
+		}
+		last = event
+	}
+	if err := simulation.Wait(); err == nil {
+		t.Error("expected an error once the broker was killed")
+	}
+	if quit, ok := last.(gol.StateChange); !ok || quit.NewState != gol.Quitting || quit.CompletedTurns != completed {
+		t.Errorf("expected the run to quit on turn %v, got %v", completed, last)
+	}
+}
+
+// Builds the command in the given package into dir and returns its path
+func buildCommand(t *testing.T, dir, pkg string) string {
+	path := filepath.Join(dir, pkg)
+	output, err := exec.Command("go", "build", "-o", path, "./"+pkg).CombinedOutput()
+	if err != nil {
+		t.Fatalf("could not build %v: %v\n%s", pkg, err, output)
+	}
+	return path
+}
+
+// Starts a command and waits until it prints a line containing ready
+func startCommand(t *testing.T, ready, path string, args ...string) *exec.Cmd {
+	cmd := exec.Command(path, args...)
+	stdout, err := cmd.StdoutPipe()
+	util.Check(err)
+	util.Check(cmd.Start())
+
+	lines := bufio.NewScanner(stdout)
+	for lines.Scan() {
+		if strings.Contains(lines.Text(), ready) {
+			// Keep reading the output so that the command never blocks on printing
+			go func() {
+				for lines.Scan() {
+				}
+			}()
+			return cmd
+		}
+	}
+	stopCommand(cmd)
+	t.Fatalf("%v %v exited without printing %q", path, args, ready)
+	return nil
+}
+
+// Kills a command started by startCommand
+func stopCommand(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+	cmd.Wait()
+}
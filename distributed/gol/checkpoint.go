@@ -0,0 +1,63 @@
+package gol
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Replaces the parameters of the world with the ones saved in a checkpoint, keeping the number of threads if one was asked for
+func resumeParams(p Params, checkpoint util.Checkpoint) Params {
+	p.Turns = checkpoint.Turns
+	p.ImageWidth = checkpoint.ImageWidth
+	p.ImageHeight = checkpoint.ImageHeight
+	p.Rule = checkpoint.Rule
+	p.Topology = checkpoint.Topology
+	if p.Threads == 0 {
+		p.Threads = checkpoint.Threads
+	}
+	return p
+}
+
+// Returns the file the checkpoint of a turn is saved to, next to the images the run writes.
+// Without an output path it is out/<W>x<H>x<turn>.checkpoint, otherwise the turn is added to the end of the name,
+// so runs/glider.png saves runs/glider-100.checkpoint.
+func checkpointFilename(p Params, turn int) string {
+	if p.Output == "" {
+		return "out/" + strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(turn) + ".checkpoint"
+	}
+	return strings.TrimSuffix(p.Output, formatExtension(p.Output)) + "-" + strconv.Itoa(turn) + ".checkpoint"
+}
+
+// Saves a snapshot of the session and the parameters of the simulation next to its images, so that it can be carried on with -resume
+// Returns the error if it couldn't be written, or an error if the snapshot is missing its world
+func saveCheckpoint(p Params, c distributorChannels, snapshot *stubs.Response, session string) error {
+	if len(snapshot.World.Rows) != p.ImageHeight {
+		return fmt.Errorf("snapshot of turn %d has %d rows, expected %d", snapshot.Turns, len(snapshot.World.Rows), p.ImageHeight)
+	}
+	filename := checkpointFilename(p, snapshot.Turns)
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	err := util.WriteCheckpoint(filename, util.Checkpoint{
+		CompletedTurns: snapshot.Turns,
+		Turns:          p.Turns,
+		Threads:        p.Threads,
+		ImageWidth:     p.ImageWidth,
+		ImageHeight:    p.ImageHeight,
+		Rule:           p.Rule,
+		Topology:       p.Topology,
+		Session:        session,
+		World:          snapshot.World,
+	})
+	if err != nil {
+		return err
+	}
+	c.events <- CheckpointComplete{snapshot.Turns, filename}
+	return nil
+}
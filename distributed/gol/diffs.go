@@ -0,0 +1,140 @@
+package gol
+
+import (
+	"net/rpc"
+
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// RPC call function to subscribe to the cells that flip every turn of a session, returns the id of the subscription
+func makeCallSubscribe(client *rpc.Client, session string) (int, error) {
+	response := new(stubs.Response)
+	err := client.Call(stubs.SubscribeHandler, stubs.Request{Session: session}, response)
+	return response.Subscriber, err
+}
+
+// RPC call function to fetch the diffs of the turns since the last call, waits a little while for at least one
+func makeCallDiffs(client *rpc.Client, session string, subscriber int) (*stubs.Response, error) {
+	response := new(stubs.Response)
+	err := client.Call(stubs.DiffsHandler, stubs.Request{Session: session, Subscriber: subscriber}, response)
+	return response, err
+}
+
+// Forwards the cells that flip on the broker as CellFlipped and TurnComplete events, starting from world at the given turn
+// A world without rows is caught up from a snapshot first. Returns once it has forwarded the turn sent on finish, or straight away if -1 is sent
+// Changes of state sent on states are forwarded once the turn they were made on has been, so that they come after its TurnComplete
+// The last turn forwarded is sent on followed once it has finished
+func followDiffs(p Params, c distributorChannels, broker *rpc.Client, session string, subscriber int, world util.BitGrid, turn int, states <-chan StateChange, finish <-chan int, followed chan<- int) {
+	var pending []StateChange
+	// Forwards the changes of state up to the turn followed so far, or all of them once nothing more is followed
+	forwardStates := func(all bool) {
+		for drained := false; !drained; {
+			select {
+			case state := <-states:
+				pending = append(pending, state)
+			default:
+				drained = true
+			}
+		}
+		for len(pending) > 0 && (all || pending[0].CompletedTurns <= turn) {
+			c.events <- pending[0]
+			pending = pending[1:]
+		}
+	}
+	defer func() {
+		forwardStates(true)
+		followed <- turn
+	}()
+	if world.Rows == nil {
+		world = util.NewBitGrid(p.ImageWidth, p.ImageHeight)
+		var ok bool
+		world, turn, ok = catchUp(p, c, broker, session, world, turn)
+		if !ok {
+			return
+		}
+	} else {
+		for _, cell := range world.AliveCells() {
+			c.events <- CellFlipped{turn, cell}
+		}
+	}
+
+	final := -1
+	for {
+		select {
+		case final = <-finish:
+			if final < 0 {
+				return
+			}
+		default:
+		}
+		if final >= 0 && turn >= final {
+			return
+		}
+
+		response, err := makeCallDiffs(broker, session, subscriber)
+		if err != nil {
+			return
+		}
+		caughtUp := !response.Missed
+		for _, diff := range response.Diffs {
+			// Cells set while paused on the turn followed so far, which are already in a world caught up since
+			if diff.Edit != nil {
+				if diff.Turn == turn {
+					for _, cell := range world.Changes(*diff.Edit) {
+						world.Rows[cell.Y].Flip(cell.X)
+						c.events <- CellFlipped{turn, cell}
+					}
+				}
+				continue
+			}
+			// Turns run again after a worker failed are the same as before
+			if diff.Turn <= turn {
+				continue
+			}
+			if diff.Turn != turn+1 {
+				caughtUp = false
+				break
+			}
+			for _, cell := range diff.Flipped {
+				world.Rows[cell.Y].Flip(cell.X)
+				c.events <- CellFlipped{diff.Turn, cell}
+			}
+			turn = diff.Turn
+			c.events <- TurnComplete{turn}
+			forwardStates(false)
+		}
+		// The session has finished, but its last turns were dropped
+		if final >= 0 && len(response.Diffs) == 0 && turn < final {
+			caughtUp = false
+		}
+
+		// Turns were dropped because this controller fell behind, so carry on from the world as it is now
+		if !caughtUp {
+			var ok bool
+			world, turn, ok = catchUp(p, c, broker, session, world, turn)
+			if !ok {
+				return
+			}
+		}
+		forwardStates(false)
+	}
+}
+
+// Catches world up with a snapshot from the broker, sending a CellFlipped event for every cell that differs
+// Returns the world and turn of the snapshot, or false if the broker couldn't send one
+func catchUp(p Params, c distributorChannels, broker *rpc.Client, session string, world util.BitGrid, turn int) (util.BitGrid, int, bool) {
+	snapshot, err := makeCallSnapshot(broker, session, p.ImageWidth, p.ImageHeight)
+	if err != nil || len(snapshot.World.Rows) != p.ImageHeight {
+		return world, turn, false
+	}
+	var flipped []util.Cell
+	for i := 0; i < p.ImageHeight; i++ {
+		flipped = util.Flipped(flipped[:0], world.Rows[i], snapshot.World.Rows[i], i)
+		for _, cell := range flipped {
+			c.events <- CellFlipped{snapshot.Turns, cell}
+		}
+	}
+	c.events <- TurnComplete{snapshot.Turns}
+	return snapshot.World, snapshot.Turns, true
+}
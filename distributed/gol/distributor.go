@@ -1,183 +1,379 @@
 package gol
 
 import (
+	"context"
 	"fmt"
 	"net/rpc"
 	"strconv"
-	"sync"
 	"time"
 	"uk.ac.bris.cs/gameoflife/stubs"
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
 type distributorChannels struct {
-	events     chan<- Event
-	ioCommand  chan<- ioCommand
-	ioIdle     <-chan bool
-	ioFilename chan<- string
-	ioOutput   chan<- uint8
-	ioInput    <-chan uint8
-	keyPresses <-chan rune
+	events       chan<- Event
+	ioCommand    chan<- ioCommand
+	ioIdle       <-chan bool
+	ioFilename   chan<- string
+	ioTurn       chan<- int
+	ioOutput     chan<- uint8
+	ioInput      <-chan uint8
+	ioInputError <-chan error
+	// Whether each image was written
+	ioOutputError <-chan error
+	keyPresses    <-chan rune
+	// Edits to the world, which the broker only makes while it is paused
+	edits <-chan util.Edit
 }
 
 const alive = 255
+const dead = 0
 
-var mu sync.Mutex
+// RPC call function from client to broker to start calculating the world from the given turn
+// Returns the id of the session it runs in, and of the subscription to the cells that flip every turn
+func makeCallStart(client *rpc.Client, world util.BitGrid, ImageWidth, ImageHeight, Turns, Threads int, Rule string, Topology util.Topology, CompletedTurns int) (*stubs.Response, error) {
+	request := stubs.Request{World: world, Width: ImageWidth, Height: ImageHeight, Turns: Turns, Kill: false, Threads: Threads, Rule: Rule, Topology: Topology, CompletedTurns: CompletedTurns, Subscribe: true}
+	response := new(stubs.Response)
+	err := client.Call(stubs.StartHandler, request, response)
+	return response, err
+}
+
+// RPC call function from client to broker to attach to a session that is already running, returns the details of its world
+func makeCallAttach(client *rpc.Client, session string) (*stubs.Response, error) {
+	response := new(stubs.Response)
+	err := client.Call(stubs.AttachHandler, stubs.Request{Session: session}, response)
+	return response, err
+}
+
+// RPC call function to leave a session, which keeps running on the broker, and stop its subscription
+func makeCallDetach(client *rpc.Client, session string, subscriber int) {
+	response := new(stubs.Response)
+	client.Call(stubs.DetachHandler, stubs.Request{Session: session, Subscriber: subscriber}, response)
+}
+
+// RPC call function to pause or resume a session, returns the turn it was paused or resumed on
+func makeCallControl(client *rpc.Client, handler, session string) (*stubs.Response, error) {
+	response := new(stubs.Response)
+	err := client.Call(handler, stubs.Request{Session: session}, response)
+	return response, err
+}
 
-// RPC call function from client to broker to calculate next state of world
-func makeCallWorld(client *rpc.Client, world [][]byte, ImageWidth, ImageHeight, Turns, Threads int) *stubs.Response {
-	request := stubs.Request{world, ImageWidth, ImageHeight, Turns, false, Threads}
+// RPC call function to set cells of a paused session, whose changes come back as a diff
+func makeCallEdit(client *rpc.Client, session string, edit util.Edit) error {
 	response := new(stubs.Response)
-	client.Call(stubs.TurnHandler, request, response)
-	return response
+	return client.Call(stubs.EditHandler, stubs.Request{Session: session, Edit: edit}, response)
 }
 
 // RPC call function from client to broker to retrieve number of alive cells and turns in current world
-func makeCallAliveCells(client *rpc.Client, world [][]byte, ImageWidth, ImageHeight, Turns, Threads int) *stubs.Response {
-	request := stubs.Request{world, ImageWidth, ImageHeight, Turns, false, Threads}
+func makeCallAliveCells(client *rpc.Client, session string) (*stubs.Response, error) {
 	response := new(stubs.Response)
-	client.Call(stubs.AliveHandler, request, response)
-	return response
+	err := client.Call(stubs.AliveHandler, stubs.Request{Session: session}, response)
+	return response, err
 }
 
 // RPC call function to retrieve current world and turns to output into a pgm file
-func makeCallSnapshot(client *rpc.Client, world [][]byte, ImageWidth, ImageHeight, Turns, Threads int) *stubs.Response {
-	request := stubs.Request{world, ImageHeight, ImageWidth, Turns, false, Threads}
+func makeCallSnapshot(client *rpc.Client, session string, ImageWidth, ImageHeight int) (*stubs.Response, error) {
+	request := stubs.Request{Width: ImageWidth, Height: ImageHeight, Session: session}
 	response := new(stubs.Response)
-	client.Call(stubs.SnapshotHandler, request, response)
-	return response
+	err := client.Call(stubs.SnapshotHandler, request, response)
+	return response, err
 }
 
 // RPC call function to close all worker servers and broker
-func closeServer(client *rpc.Client, world [][]byte, ImageWidth, ImageHeight, Turns, Threads int) {
-	request := stubs.Request{world, ImageWidth, ImageHeight, Turns, true, Threads}
+func closeServer(client *rpc.Client, ImageWidth, ImageHeight, Turns, Threads int) {
+	request := stubs.Request{Width: ImageWidth, Height: ImageHeight, Turns: Turns, Kill: true, Threads: Threads}
 	response := new(stubs.Response)
 	client.Call(stubs.ShutHandler, request, response)
 	return
 }
 
-// Calculates number of alive cells in the world after each iteration, it returns a slice with type util.Cell
-func calculateAliveCells(p Params, world [][]byte) []util.Cell {
-	var aliveCells []util.Cell
+// Function to create world and initialise state from input, packed one bit per cell
+func createWorld(p Params, c distributorChannels) util.BitGrid {
+	world := util.NewBitGrid(p.ImageWidth, p.ImageHeight)
+
+	// Receive image byte by byte and store in the world
 	for i := 0; i < p.ImageHeight; i++ {
 		for j := 0; j < p.ImageWidth; j++ {
-			if world[i][j] == alive {
-				newCell := util.Cell{X: j, Y: i}
-				aliveCells = append(aliveCells, newCell)
-			}
+			world.Rows[i].Set(j, <-c.ioInput == alive)
 		}
 	}
-	return aliveCells
+	return world
 }
 
-// Function to create world and initialise state from input
-func createWorld(p Params, c distributorChannels) [][]byte {
-	world := make([][]byte, p.ImageHeight)
-	for i := range world {
-		world[i] = make([]byte, p.ImageWidth)
-	}
+// Reports that the world couldn't be read, which ends the run before its first turn without a FinalTurnComplete event
+func inputFailed(p Params, c distributorChannels, err error) error {
+	c.events <- ImageInputError{CompletedTurns: 0, Filename: inputFilename(p), Err: err}
+	c.events <- StateChange{0, Quitting}
+	return inputError{err}
+}
 
-	// Receive image byte by byte and store in 2d world
-	for i := 0; i < p.ImageHeight; i++ {
-		for j := 0; j < p.ImageWidth; j++ {
-			world[i][j] = <-c.ioInput
-		}
+// inputError is the error of a world that couldn't be read, which has been reported with an ImageInputError event
+type inputError struct {
+	error
+}
+
+// Returns the file the world is read from, which is the image named after the size of the world unless another one is given
+func inputFilename(p Params) string {
+	if p.Input != "" {
+		return p.Input
 	}
-	return world
+	return "images/" + strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + ".pgm"
 }
 
 // Outputs image into ioOutput and sends event imageOutputComplete to events channel
-func outImage(p Params, c distributorChannels, snapshot *stubs.Response) {
+// The world is only turned back into bytes here, as PGM images have a byte per cell
+// Returns the error from io if the image couldn't be written, or an error if the snapshot is missing its world
+func outImage(p Params, c distributorChannels, snapshot *stubs.Response) error {
+	if len(snapshot.World.Rows) != p.ImageHeight {
+		return fmt.Errorf("snapshot of turn %d has %d rows, expected %d", snapshot.Turns, len(snapshot.World.Rows), p.ImageHeight)
+	}
 	// Sets command to output
 	c.ioCommand <- ioOutput
-	outfile := strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(snapshot.Turns)
-	// Write file name
+	outfile := outputFilename(p, snapshot.Turns)
+	// Write file name and the turn of the image
 	c.ioFilename <- outfile
+	c.ioTurn <- snapshot.Turns
 	// Outputs file byte by byte
 	for i := 0; i < p.ImageHeight; i++ {
 		for j := 0; j < p.ImageWidth; j++ {
-			c.ioOutput <- snapshot.World[i][j]
+			if snapshot.World.Rows[i].Get(j) {
+				c.ioOutput <- alive
+			} else {
+				c.ioOutput <- dead
+			}
 		}
 	}
+	if err := <-c.ioOutputError; err != nil {
+		return err
+	}
 	// Notify events channel that image output done, with relevant turns and filename
 	c.events <- ImageOutputComplete{snapshot.Turns, outfile}
+	return nil
 }
 
-// distributor divides the work between workers and interacts with other goroutines.
-func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
-	c.ioCommand <- ioInput
-	// Create filename from parameters and send down the filename channel
-	filename := strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(p.ImageHeight)
-	c.ioFilename <- filename
-	// TODO: Create a 2D slice to store the world.
-	world := createWorld(p, c)
+// Returns the address of the broker, which is on this machine unless given in the parameters
+func brokerAddress(p Params) string {
+	if p.Broker == "" {
+		return "127.0.0.1:8030"
+	}
+	return p.Broker
+}
 
-	// TODO: Execute all turns of the Game of Life.
+// Attaches to a session that is already running, and returns the parameters of its world in place of the given ones
+func attachSession(p Params) (Params, error) {
+	broker, err := rpc.Dial("tcp", brokerAddress(p))
+	if err != nil {
+		return p, err
+	}
+	defer broker.Close()
+	attached, err := makeCallAttach(broker, p.Session)
+	if err != nil {
+		return p, err
+	}
+	p.ImageWidth, p.ImageHeight, p.Turns, p.Threads = attached.Width, attached.Height, attached.Turns, attached.Threads
+	p.Rule, p.Topology = attached.Rule, attached.Topology
+	return p, nil
+}
+
+// distributor divides the work between workers and interacts with other goroutines.
+// When ctx is cancelled it detaches like q without writing the world, leaving the session running on the broker,
+// and returns the error of ctx. Errors calling the broker are returned too.
+// An image or checkpoint that can't be written, or a pause or resume the broker fails, detaches in the same way,
+// returning the error without a FinalTurnComplete event.
+func distributor(ctx context.Context, p Params, c distributorChannels, keyPresses <-chan rune, resumed *util.Checkpoint) error {
+	// Check the rule before sending it to the broker, so that a typo fails here rather than on the workers
+	_, err := util.ParseRule(p.Rule)
+	util.Check(err)
 
 	// Dials to broker
-	broker, _ := rpc.Dial("tcp", "127.0.0.1:8030")
+	broker, err := rpc.Dial("tcp", brokerAddress(p))
+	if err != nil {
+		return err
+	}
 	defer broker.Close()
 
+	session := p.Session
+	subscriber := 0
+	// World the cells that flip on the broker are applied to, without rows when attaching as it is caught up from a snapshot
+	var world util.BitGrid
+	turn := 0
+	if session == "" {
+		if resumed != nil {
+			// Carry on from the world and turn saved in the checkpoint instead of reading the image
+			world = resumed.World
+			turn = resumed.CompletedTurns
+		} else {
+			c.ioCommand <- ioInput
+			c.ioFilename <- inputFilename(p)
+			if err := <-c.ioInputError; err != nil {
+				return inputFailed(p, c, err)
+			}
+			world = createWorld(p, c)
+		}
+
+		// The broker runs the world in a new session, which keeps running if this controller quits
+		started, err := makeCallStart(broker, world, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads, p.Rule, p.Topology, turn)
+		if err != nil {
+			return err
+		}
+		session = started.Session
+		subscriber = started.Subscriber
+	} else {
+		subscriber, err = makeCallSubscribe(broker, session)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println("Session:", session)
+
+	// Forwards the cells that flip on the broker as events, until it is sent the turn to finish on
+	// Pausing and resuming are forwarded by it too, after the turns before them
+	states := make(chan StateChange, 10)
+	finish := make(chan int, 1)
+	followed := make(chan int)
+	go followDiffs(p, c, broker, session, subscriber, world, turn, states, finish, followed)
+
 	// Ticker that ticks every 2s to count number of alive cells
 	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	// Ticker to save checkpoints periodically, a nil channel never ticks when checkpoints are only saved on c
+	var checkpoints <-chan time.Time
+	if p.Checkpoint > 0 {
+		checkpointTicker := time.NewTicker(p.Checkpoint)
+		defer checkpointTicker.Stop()
+		checkpoints = checkpointTicker.C
+	}
 	// Bool value to determine if execution is paused or running
+	// A session attached to may already have been paused by another controller
 	pPressed := false
-	// Bool channel to exit out of the following go routine when it is execution is done
+	status, err := makeCallAliveCells(broker, session)
+	if err != nil {
+		makeCallDetach(broker, session, subscriber)
+		finish <- -1
+		<-followed
+		return err
+	}
+	if status.Paused {
+		states <- StateChange{status.Turns, Paused}
+		pPressed = true
+	}
+	// Closed to exit out of the following go routine when execution is done, which closes exited once it has returned
 	done := make(chan bool)
-	key := 'a'
+	exited := make(chan bool)
+	// Receives the world to finish with when q or k is pressed, along with whether k was pressed
+	// Nil is received instead when the simulation is cancelled
+	quit := make(chan *stubs.Response, 1)
+	killed := false
+	// Detaches and stops the run when an image or checkpoint can't be written or a call to the broker fails,
+	// read once the goroutine has exited
+	var failure error
+	fail := func(err error) {
+		failure = err
+		makeCallDetach(broker, session, subscriber)
+		quit <- nil
+	}
 
 	// Goroutine to check if any keys pressed, ticker is ticking, or
 	go func() {
+		defer close(exited)
 		for {
 			select {
 			// Receives keys pressed
-			case key = <-keyPresses:
-				// Calls to receive current world to be saved into a pgm file
-				snapshot := makeCallSnapshot(broker, world, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+			case key := <-keyPresses:
 				switch key {
-				// save image
+				// save image, of the paused turn if paused
 				case 's':
-					outImage(p, c, snapshot)
-				// client quits and disconnects
+					snapshot, err := makeCallSnapshot(broker, session, p.ImageWidth, p.ImageHeight)
+					if err == nil {
+						err = outImage(p, c, snapshot)
+					}
+					if err != nil {
+						fail(err)
+						return
+					}
+				// save a checkpoint that can be carried on from with -resume
+				case 'c':
+					snapshot, err := makeCallSnapshot(broker, session, p.ImageWidth, p.ImageHeight)
+					if err == nil {
+						err = saveCheckpoint(p, c, snapshot, session)
+					}
+					if err != nil {
+						fail(err)
+						return
+					}
+				// client quits and detaches, leaving the world running on the broker, or paused for the next controller
 				case 'q':
-					c.events <- StateChange{snapshot.Turns, Quitting}
-					outImage(p, c, snapshot)
-					fmt.Println("Quitting")
-					c.events <- FinalTurnComplete{snapshot.Turns, calculateAliveCells(p, snapshot.World)}
-				// execution paused
+					snapshot, err := makeCallSnapshot(broker, session, p.ImageWidth, p.ImageHeight)
+					if err != nil {
+						fail(err)
+						return
+					}
+					makeCallDetach(broker, session, subscriber)
+					fmt.Println("Quitting, reattach with -session", session)
+					quit <- snapshot
+					return
+				// execution paused at the end of the turn the broker is on, or continued from it
 				case 'p':
-					c.events <- StateChange{snapshot.Turns, Paused}
-					pPressed = true
-					for {
-						switch <-keyPresses {
-						case 'p':
-							c.events <- StateChange{snapshot.Turns, Executing}
-							fmt.Println("Continuing")
-							pPressed = false
+					if pPressed {
+						resumed, err := makeCallControl(broker, stubs.ResumeHandler, session)
+						if err != nil {
+							fail(err)
+							return
 						}
-						if !pPressed {
-							break
+						states <- StateChange{resumed.Turns, Executing}
+						fmt.Println("Continuing")
+					} else {
+						paused, err := makeCallControl(broker, stubs.PauseHandler, session)
+						if err != nil {
+							fail(err)
+							return
 						}
+						states <- StateChange{paused.Turns, Paused}
 					}
+					pPressed = !pPressed
 				// Client kills broker and servers shuts whole system down
 				case 'k':
-					outImage(p, c, snapshot)
+					snapshot, err := makeCallSnapshot(broker, session, p.ImageWidth, p.ImageHeight)
+					if err != nil {
+						fail(err)
+						return
+					}
 					fmt.Println("Quitting and killing server")
-					closeServer(broker, world, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
-					c.events <- FinalTurnComplete{snapshot.Turns, calculateAliveCells(p, snapshot.World)}
-					c.events <- StateChange{snapshot.Turns, Quitting}
-					close(c.events)
-					c.ioCommand <- ioCheckIdle
-					<-c.ioIdle
+					killed = true
+					quit <- snapshot
 					return
 				}
-			// When done receives a true value, it returns out of this go routine function
+			// Cells clicked in the window, which the broker turns down unless the session is paused
+			case edit := <-c.edits:
+				if err := makeCallEdit(broker, session, edit); err != nil {
+					fmt.Println("Edit failed:", err)
+				}
+			// Saves a checkpoint every p.Checkpoint
+			case <-checkpoints:
+				snapshot, err := makeCallSnapshot(broker, session, p.ImageWidth, p.ImageHeight)
+				if err == nil {
+					err = saveCheckpoint(p, c, snapshot, session)
+				}
+				if err != nil {
+					fail(err)
+					return
+				}
+			// When done is closed, it returns out of this go routine function
 			case <-done:
 				return
+			// Detaches when the simulation is cancelled, without a world to finish with
+			case <-ctx.Done():
+				makeCallDetach(broker, session, subscriber)
+				quit <- nil
+				return
 			// When ticker ticks every 2s
 			case <-ticker.C:
 				// Makes rpc call function to retrieve num of alive cells
-				tick := makeCallAliveCells(broker, world, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+				tick, err := makeCallAliveCells(broker, session)
+				if err != nil {
+					fail(err)
+					return
+				}
 				cells := AliveCellsCount{tick.Turns, tick.AliveCells}
 				// Sends it down events channel to update num of alive cells
 				c.events <- cells
@@ -185,30 +381,58 @@ func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
 		}
 	}()
 
-	// Retrieves response that contains world number of alive cells, turns completed
-	mu.Lock()
-	response := makeCallWorld(broker, world, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
-	mu.Unlock()
-	// TODO: RPC Client code
-
-	// TODO: Report the final state using FinalTurnCompleteEvent.
-	// if k pressed return
-	if key == 'k' {
-		return
+	// Waits for the session to finish, unless this controller quits first
+	// The broker recovers from failed workers itself, so an error here means the world is lost
+	response := new(stubs.Response)
+	call := broker.Go(stubs.WaitHandler, stubs.Request{Session: session}, response, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		close(done)
+		<-exited
+		if call.Error != nil {
+			finish <- -1
+			c.events <- StateChange{<-followed, Quitting}
+			return call.Error
+		}
+		if failure != nil {
+			finish <- -1
+			response = nil
+		} else {
+			// Forward the turns up to the final one before finishing
+			finish <- response.Turns
+		}
+	case response = <-quit:
+		finish <- -1
 	}
+	// Turn the events got up to, which is where the run stops when there is no world to finish with
+	followedTurn := <-followed
+	if response == nil {
+		<-exited
+		c.events <- StateChange{followedTurn, Quitting}
+		if failure != nil {
+			return failure
+		}
+		return ctx.Err()
+	}
+
 	// Outputs world
-	outImage(p, c, response)
-	last := FinalTurnComplete{CompletedTurns: response.Turns, Alive: calculateAliveCells(p, response.World)}
-	// Tick until final turn
-	done <- true
+	if err := outImage(p, c, response); err != nil {
+		if killed {
+			closeServer(broker, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+		}
+		c.events <- StateChange{response.Turns, Quitting}
+		return err
+	}
+	last := FinalTurnComplete{CompletedTurns: response.Turns, Alive: response.World.AliveCells()}
 	// Sends FinalTurnComplete event to events channel
 	c.events <- last
+	if killed {
+		closeServer(broker, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+	}
 
 	c.events <- StateChange{response.Turns, Quitting}
 	// Make sure that the Io has finished any output before exiting.
 	c.ioCommand <- ioCheckIdle
 	<-c.ioIdle
-
-	// Close the channel to stop the SDL goroutine gracefully. Removing may cause deadlock.
-	close(c.events)
+	return nil
 }
@@ -28,6 +28,21 @@ type ImageOutputComplete struct { // implements Event
 	Filename       string
 }
 
+// ImageInputError is an Event notifying the user that the image or pattern the world is read from couldn't be read.
+// The run ends after this Event is sent, without a FinalTurnComplete.
+type ImageInputError struct { // implements Event
+	CompletedTurns int
+	Filename       string
+	Err            error
+}
+
+// CheckpointComplete is an Event notifying the user that a checkpoint of the simulation has been saved.
+// This Event should be sent every time a checkpoint is written, periodically or when c is pressed.
+type CheckpointComplete struct { // implements Event
+	CompletedTurns int
+	Filename       string
+}
+
 // State represents a change in the state of execution.
 type State int
 
@@ -47,6 +62,8 @@ type StateChange struct { // implements Event
 // CellFlipped is an Event notifying the GUI about a change of state of a single cell.
 // This even should be sent every time a cell changes state.
 // Make sure to send this event for all cells that are alive when the image is loaded in.
+// CompletedTurns is the turn the cell flips on, which is the turn of the TurnComplete sent after it.
+// The cells alive when the image is loaded in flip on the turn the world starts from.
 type CellFlipped struct { // implements Event
 	CompletedTurns int
 	Cell           util.Cell
@@ -106,6 +123,22 @@ func (event ImageOutputComplete) GetCompletedTurns() int {
 	return event.CompletedTurns
 }
 
+func (event ImageInputError) String() string {
+	return fmt.Sprintf("Input failed: %v", event.Err)
+}
+
+func (event ImageInputError) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event CheckpointComplete) String() string {
+	return fmt.Sprintf("Checkpoint %v saved", event.Filename)
+}
+
+func (event CheckpointComplete) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
 func (event CellFlipped) String() string {
 	return fmt.Sprintf("")
 }
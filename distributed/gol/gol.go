@@ -1,40 +1,66 @@
 package gol
 
+import (
+	"context"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
 // Params provides the details of how to run the Game of Life and which image to load.
 type Params struct {
 	Turns       int
 	Threads     int
 	ImageWidth  int
 	ImageHeight int
+	// Rule is a Life-like rulestring such as "B36/S23". Empty means Conway's B3/S23.
+	Rule string
+	// Topology decides what lies beyond the edges of the world. The zero value is the torus.
+	Topology util.Topology
+	// Broker is the address of the broker. Empty means 127.0.0.1:8030.
+	Broker string
+	// Session is the id of a session running on the broker to attach to. Empty means start a new one from the image.
+	Session string
+	// Input is the pgm image, RLE pattern or plaintext pattern the world is read from.
+	// Empty means the image in images/ named after the size of the world.
+	Input string
+	// Offset is where the top left corner of an RLE or plaintext pattern goes in the world.
+	Offset util.Cell
+	// Output is where images and checkpoints are written, with the turn added to the end of the name. Empty means out/<W>x<H>x<turn>.
+	// Its extension picks the format unless Format is given.
+	Output string
+	// Format is the format images are written in: pgm, p2, pbm, rle or png, optionally followed by .gz. Empty means pgm.
+	Format string
+	// CellSize is the number of pixels along each side of a cell in PNG images. Zero means 1.
+	CellSize int
+	// AliveColour and DeadColour are the colours of cells in PNG images as rrggbb. Empty means white and black.
+	AliveColour string
+	DeadColour  string
+	// Record is a .gif or .png file that Record writes frames of the world into. Empty means nothing is recorded.
+	Record string
+	// RecordFrom and RecordTo are the first and last turns recorded, where a RecordTo of zero means the last turn of the run.
+	RecordFrom int
+	RecordTo   int
+	// RecordEvery is the number of turns between frames. Zero means 1.
+	RecordEvery int
+	// RecordDelay is how long each frame of a GIF is shown for. Zero means 100ms.
+	RecordDelay time.Duration
+	// Resume is a checkpoint to carry on from in a new session, whose world and parameters replace the image and the ones given here.
+	Resume string
+	// Checkpoint is how often to save a checkpoint, next to the images as Output with the turn and .checkpoint added to the end
+	// of the name. Empty Output means out/<W>x<H>x<turn>.checkpoint. Zero means only when c is pressed.
+	Checkpoint time.Duration
 }
 
 // Run starts the processing of Game of Life. It should initialise channels and goroutines.
+// It returns once the simulation has finished, and panics if the parameters are invalid where Start returns an error instead.
 func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
-
-	//	TODO: Put the missing channels in here.
-
-	ioCommand := make(chan ioCommand)
-	ioIdle := make(chan bool)
-	ioFilename := make(chan string)
-	ioOutput := make(chan uint8)
-	ioInput := make(chan uint8)
-
-	ioChannels := ioChannels{
-		command:  ioCommand,
-		idle:     ioIdle,
-		filename: ioFilename,
-		output:   ioOutput,
-		input:    ioInput,
-	}
-	go startIo(p, ioChannels)
-
-	distributorChannels := distributorChannels{
-		events:     events,
-		ioCommand:  ioCommand,
-		ioIdle:     ioIdle,
-		ioFilename: ioFilename,
-		ioOutput:   ioOutput,
-		ioInput:    ioInput,
+	simulation, err := Start(context.Background(), p, WithEvents(events), WithKeyPresses(keyPresses))
+	util.Check(err)
+	// A world that can't be read has already been reported with an ImageInputError event, but losing the broker can't be
+	if err := simulation.Wait(); err != nil {
+		if _, ok := err.(inputError); !ok {
+			panic(err)
+		}
 	}
-	distributor(p, distributorChannels, keyPresses)
 }
@@ -0,0 +1,171 @@
+package gol
+
+import (
+	"compress/gzip"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Formats images can be written in, by the names they can be given as
+var imageFormats = map[string]string{
+	"pgm":      "p5",
+	"p5":       "p5",
+	"p2":       "p2",
+	"plainpgm": "p2",
+	"pbm":      "p1",
+	"p1":       "p1",
+	"rle":      "rle",
+	"png":      "png",
+}
+
+// Extension of the files written in each format
+var formatExtensions = map[string]string{
+	"p5":  ".pgm",
+	"p2":  ".pgm",
+	"p1":  ".pbm",
+	"rle": ".rle",
+	"png": ".png",
+}
+
+// imageFormat is how images are written, from the Format parameter or else the extension of the Output path.
+type imageFormat struct {
+	// One of p5, p2, p1, rle or png
+	kind string
+	gzip bool
+}
+
+// Returns the extension of a path that names a format, such as .rle.gz, or an empty string if it doesn't name one
+func formatExtension(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".gz" {
+		ext = strings.ToLower(filepath.Ext(strings.TrimSuffix(path, filepath.Ext(path)))) + ext
+	}
+	if _, ok := imageFormats[strings.TrimSuffix(strings.TrimPrefix(ext, "."), ".gz")]; !ok {
+		return ""
+	}
+	return ext
+}
+
+// Works out the format images are written in, which is binary PGM unless the parameters ask for another
+func outputFormat(p Params) (imageFormat, error) {
+	name := strings.ToLower(strings.TrimSpace(p.Format))
+	if name == "" {
+		name = strings.TrimPrefix(formatExtension(p.Output), ".")
+	}
+	if name == "" {
+		name = "pgm"
+	}
+	var format imageFormat
+	if strings.HasSuffix(name, ".gz") {
+		format.gzip = true
+		name = strings.TrimSuffix(name, ".gz")
+	}
+	kind, ok := imageFormats[name]
+	if !ok {
+		return format, fmt.Errorf("unknown image format %q: expected pgm, p2, pbm, rle or png, optionally followed by .gz", p.Format)
+	}
+	format.kind = kind
+	return format, nil
+}
+
+// Returns the colours of alive and dead cells in PNG images, white and black unless the parameters give others
+func outputColours(p Params) (alive, dead color.RGBA, err error) {
+	alive, dead = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, color.RGBA{A: 0xff}
+	if p.AliveColour != "" {
+		alive, err = util.ParseColour(p.AliveColour)
+	}
+	if err == nil && p.DeadColour != "" {
+		dead, err = util.ParseColour(p.DeadColour)
+	}
+	return alive, dead, err
+}
+
+// Checks that the parameters for writing images make sense, so that a mistake is found before the run instead of at the end
+func checkOutput(p Params) error {
+	if _, err := outputFormat(p); err != nil {
+		return err
+	}
+	_, _, err := outputColours(p)
+	return err
+}
+
+// Returns the file the image of a turn is written to.
+// Without an output path it is out/<W>x<H>x<turn>, otherwise the turn is added to the end of the name,
+// so runs/glider.png becomes runs/glider-100.png.
+func outputFilename(p Params, turn int) string {
+	if p.Output == "" {
+		return "out/" + strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(turn) + outputExtension(p)
+	}
+	return strings.TrimSuffix(p.Output, formatExtension(p.Output)) + "-" + strconv.Itoa(turn) + outputExtension(p)
+}
+
+// Returns the extension of the images the parameters ask for, such as .pgm or .rle.gz
+func outputExtension(p Params) string {
+	format, err := outputFormat(p)
+	util.Check(err)
+	ext := formatExtensions[format.kind]
+	if format.gzip {
+		ext += ".gz"
+	}
+	return ext
+}
+
+// Writes the world as it was on a turn to a file in the format the parameters ask for
+// Comments are added to the end of the ones RLE patterns are written with, and left out of other formats
+func writeImageFile(filename string, world util.BitGrid, p Params, turn int, comments ...string) error {
+	format, err := outputFormat(p)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var w io.Writer = file
+	var zipped *gzip.Writer
+	if format.gzip {
+		zipped = gzip.NewWriter(file)
+		w = zipped
+	}
+
+	switch format.kind {
+	case "p5":
+		err = util.WritePGM(w, world, false)
+	case "p2":
+		err = util.WritePGM(w, world, true)
+	case "p1":
+		err = util.WritePBM(w, world)
+	case "rle":
+		var rule util.Rule
+		rule, err = util.ParseRule(p.Rule)
+		if err == nil {
+			comments = append([]string{"#N " + strings.TrimSuffix(filepath.Base(filename), formatExtension(filename)), fmt.Sprintf("#C Generation %d", turn)}, comments...)
+			err = util.WriteRLE(w, world, rule, comments...)
+		}
+	case "png":
+		var alive, dead color.RGBA
+		alive, dead, err = outputColours(p)
+		if err == nil {
+			err = util.WritePNG(w, world, p.CellSize, alive, dead)
+		}
+	}
+	if err == nil && zipped != nil {
+		err = zipped.Close()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	return err
+}
@@ -0,0 +1,165 @@
+package gol
+
+import (
+	"fmt"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// recorder keeps its own copy of the world from CellFlipped events and takes a frame of it when a turn is complete.
+type recorder struct {
+	p           Params
+	alive, dead color.RGBA
+	world       util.BitGrid
+	// Turn the world is on, and the last turn a frame was considered for so that none is taken twice
+	turn, captured int
+	// Frames of the animated GIF, which is written at the end
+	animation *gif.GIF
+}
+
+// Record subscribes to the events of a run and passes every one of them on, while recording frames of the world
+// from p.RecordFrom to p.RecordTo every p.RecordEvery turns. Frames go into an animated GIF when p.Record ends in .gif,
+// or into numbered PNG images such as runs/glider-000100.png when it ends in .png.
+// An ImageOutputComplete event is sent for every file written, before the FinalTurnComplete event.
+// The events are passed on unchanged when p.Record is empty.
+func Record(p Params, events <-chan Event) (<-chan Event, error) {
+	if p.Record == "" {
+		return events, nil
+	}
+	if err := checkRecord(p); err != nil {
+		return nil, err
+	}
+	alive, dead, err := outputColours(p)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{p: p, alive: alive, dead: dead, world: util.NewBitGrid(p.ImageWidth, p.ImageHeight), turn: -1, captured: -1}
+	if recordFormat(p) == ".gif" {
+		r.animation = &gif.GIF{}
+	}
+
+	recorded := make(chan Event, cap(events))
+	go func() {
+		defer close(recorded)
+		for event := range events {
+			switch e := event.(type) {
+			case CellFlipped:
+				// The first flip of a turn means the world before it is complete
+				if e.CompletedTurns > r.turn {
+					r.capture(recorded)
+					r.turn = e.CompletedTurns
+				}
+				if e.Cell.X >= 0 && e.Cell.Y >= 0 && e.Cell.X < r.world.Width && e.Cell.Y < r.world.Height {
+					r.world.Rows[e.Cell.Y].Flip(e.Cell.X)
+				}
+			case TurnComplete:
+				r.turn = e.CompletedTurns
+				r.capture(recorded)
+			case FinalTurnComplete:
+				r.turn = e.CompletedTurns
+				r.capture(recorded)
+				r.finish(recorded)
+			}
+			recorded <- event
+		}
+		// A run that stops without a FinalTurnComplete event still gets its GIF
+		r.finish(recorded)
+	}()
+	return recorded, nil
+}
+
+// Returns the extension of the recording, which picks between an animated GIF and PNG frames
+func recordFormat(p Params) string {
+	return strings.ToLower(filepath.Ext(p.Record))
+}
+
+// Checks that the parameters for recording make sense, so that a mistake is found before the run instead of at the end
+func checkRecord(p Params) error {
+	if format := recordFormat(p); format != ".gif" && format != ".png" {
+		return fmt.Errorf("can't record to %q: expected a .gif or .png file", p.Record)
+	}
+	if p.RecordFrom < 0 || p.RecordEvery < 0 || p.RecordDelay < 0 {
+		return fmt.Errorf("can't record from turn %d every %d turns with a delay of %v", p.RecordFrom, p.RecordEvery, p.RecordDelay)
+	}
+	if p.RecordTo > 0 && p.RecordTo < p.RecordFrom {
+		return fmt.Errorf("can't record from turn %d to turn %d", p.RecordFrom, p.RecordTo)
+	}
+	return nil
+}
+
+// Returns whether a frame of a turn is wanted
+func (r *recorder) wanted(turn int) bool {
+	every := r.p.RecordEvery
+	if every == 0 {
+		every = 1
+	}
+	return turn >= r.p.RecordFrom && (r.p.RecordTo == 0 || turn <= r.p.RecordTo) && (turn-r.p.RecordFrom)%every == 0
+}
+
+// Takes a frame of the world as it is on the current turn, if one is wanted and hasn't been taken yet
+func (r *recorder) capture(events chan<- Event) {
+	if r.turn == r.captured || !r.wanted(r.turn) {
+		r.captured = r.turn
+		return
+	}
+	r.captured = r.turn
+	frame := util.PalettedImage(r.world, r.p.CellSize, r.alive, r.dead)
+	if r.animation != nil {
+		r.animation.Image = append(r.animation.Image, frame)
+		r.animation.Delay = append(r.animation.Delay, recordDelay(r.p))
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%06d.png", strings.TrimSuffix(r.p.Record, filepath.Ext(r.p.Record)), r.turn)
+	util.Check(writeFrame(filename, func(file *os.File) error {
+		return png.Encode(file, frame)
+	}))
+	events <- ImageOutputComplete{CompletedTurns: r.turn, Filename: filename}
+}
+
+// Writes the animated GIF once the run is over
+func (r *recorder) finish(events chan<- Event) {
+	if r.animation == nil || len(r.animation.Image) == 0 {
+		return
+	}
+	frames := *r.animation
+	r.animation.Image, r.animation.Delay = nil, nil
+	util.Check(writeFrame(r.p.Record, func(file *os.File) error {
+		return gif.EncodeAll(file, &frames)
+	}))
+	events <- ImageOutputComplete{CompletedTurns: r.turn, Filename: r.p.Record}
+}
+
+// Returns the time each frame of the GIF is shown for, in the hundredths of a second GIFs count in. Zero means 100ms.
+func recordDelay(p Params) int {
+	if p.RecordDelay == 0 {
+		return 10
+	}
+	if delay := int(p.RecordDelay / (10 * time.Millisecond)); delay > 0 {
+		return delay
+	}
+	return 1
+}
+
+// Creates a file, making its directory if needed, and writes to it
+func writeFrame(filename string, write func(file *os.File) error) error {
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := write(file); err != nil {
+		return err
+	}
+	return file.Sync()
+}
@@ -0,0 +1,242 @@
+package gol
+
+import (
+	"context"
+	"fmt"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Simulation is a Game of Life started with Start. It runs until its turns are done, q is pressed or its context is cancelled.
+type Simulation struct {
+	// Events are the events of the simulation, which is closed once it has finished.
+	// They have to be read until then, unless the context is cancelled. Nil when WithEvents is given.
+	Events <-chan Event
+
+	keyPresses chan<- rune
+	edits      chan<- util.Edit
+	done       chan struct{}
+	err        error
+}
+
+// Option changes how Start runs a simulation.
+type Option func(*options)
+
+type options struct {
+	events     chan<- Event
+	keyPresses <-chan rune
+	edits      <-chan util.Edit
+	buffer     int
+}
+
+// WithEvents sends the events of the simulation to a channel of the caller's instead of Simulation.Events.
+// The channel is closed once the simulation has finished.
+func WithEvents(events chan<- Event) Option {
+	return func(o *options) {
+		o.events = events
+	}
+}
+
+// WithKeyPresses reads key presses from a channel of the caller's instead of Simulation.Press.
+func WithKeyPresses(keyPresses <-chan rune) Option {
+	return func(o *options) {
+		o.keyPresses = keyPresses
+	}
+}
+
+// WithEdits reads edits to the world from a channel of the caller's instead of Simulation.Edit.
+// Edits are only made while the simulation is paused, and fail on the broker otherwise.
+func WithEdits(edits <-chan util.Edit) Option {
+	return func(o *options) {
+		o.edits = edits
+	}
+}
+
+// WithEventBuffer sets how many events Simulation.Events holds before the simulation waits for them to be read.
+// Defaults to 1000.
+func WithEventBuffer(size int) Option {
+	return func(o *options) {
+		o.buffer = size
+	}
+}
+
+// Start checks the parameters and starts running the Game of Life in the background, returning an error if they are invalid.
+// Cancelling ctx detaches from the session without writing the world, leaving it running on the broker,
+// and Wait returns the error of ctx.
+// Once the simulation has finished, all of the goroutines it started have returned or are about to.
+func Start(ctx context.Context, p Params, opts ...Option) (*Simulation, error) {
+	o := options{buffer: 1000}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// The size and rule of the world come from the broker when attaching to a session that is already running
+	if p.Session != "" {
+		var err error
+		if p, err = attachSession(p); err != nil {
+			return nil, err
+		}
+	}
+
+	// Carry on from a checkpoint, whose world is handed to the distributor instead of reading the image
+	var resumed *util.Checkpoint
+	if p.Resume != "" {
+		checkpoint, err := util.ReadCheckpoint(p.Resume)
+		if err != nil {
+			return nil, err
+		}
+		p = resumeParams(p, checkpoint)
+		resumed = &checkpoint
+	} else if p.Session == "" && p.Rule == "" && util.IsPatternFile(p.Input) {
+		// A pattern can give its own rule, which is used unless another one is given.
+		// One that can't be read is reported when io reads the world.
+		if pattern, err := util.ReadPattern(p.Input); err == nil {
+			p.Rule = pattern.Rule
+		}
+	}
+	if err := checkParams(p); err != nil {
+		return nil, err
+	}
+
+	s := &Simulation{done: make(chan struct{})}
+	events := o.events
+	if events == nil {
+		ownEvents := make(chan Event, o.buffer)
+		events, s.Events = ownEvents, ownEvents
+	}
+	keyPresses := o.keyPresses
+	if keyPresses == nil {
+		ownKeyPresses := make(chan rune, 10)
+		keyPresses, s.keyPresses = ownKeyPresses, ownKeyPresses
+	}
+	edits := o.edits
+	if edits == nil {
+		ownEdits := make(chan util.Edit, 10)
+		edits, s.edits = ownEdits, ownEdits
+	}
+
+	// Once cancelled, nobody may be reading the events any more, so they go through a goroutine that drops them instead
+	// of leaving the simulation stuck sending them. A context that can't be cancelled doesn't need it.
+	sent := events
+	if ctx.Done() != nil {
+		forwarded := make(chan Event, cap(events))
+		go forwardEvents(ctx, forwarded, events)
+		sent = forwarded
+	}
+
+	ioCommand := make(chan ioCommand)
+	ioIdle := make(chan bool)
+	ioFilename := make(chan string)
+	ioTurn := make(chan int)
+	ioOutput := make(chan uint8)
+	ioInput := make(chan uint8)
+	ioInputError := make(chan error)
+	ioOutputError := make(chan error)
+
+	ioChannels := ioChannels{
+		command:     ioCommand,
+		idle:        ioIdle,
+		filename:    ioFilename,
+		turn:        ioTurn,
+		output:      ioOutput,
+		input:       ioInput,
+		inputError:  ioInputError,
+		outputError: ioOutputError,
+	}
+	go startIo(p, ioChannels)
+
+	distributorChannels := distributorChannels{
+		events:        sent,
+		ioCommand:     ioCommand,
+		ioIdle:        ioIdle,
+		ioFilename:    ioFilename,
+		ioTurn:        ioTurn,
+		ioOutput:      ioOutput,
+		ioInput:       ioInput,
+		ioInputError:  ioInputError,
+		ioOutputError: ioOutputError,
+		edits:         edits,
+	}
+	go func() {
+		s.err = distributor(ctx, p, distributorChannels, keyPresses, resumed)
+		// Stop io, and close the channel to stop the SDL goroutine gracefully. Removing may cause deadlock.
+		close(ioCommand)
+		close(sent)
+		close(s.done)
+	}()
+	return s, nil
+}
+
+// Passes events on until the context is cancelled, then drops the rest so that the simulation can finish
+func forwardEvents(ctx context.Context, from <-chan Event, to chan<- Event) {
+	defer close(to)
+	for event := range from {
+		select {
+		case to <- event:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// Press sends a key press to the simulation, as if the key was pressed in the window.
+// Returns false if the simulation has already finished. Does nothing but wait when WithKeyPresses is given.
+func (s *Simulation) Press(key rune) bool {
+	// The key presses are buffered, so they could still be sent after the simulation has finished
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+	select {
+	case s.keyPresses <- key:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// Edit sends an edit to the simulation, as if cells were clicked in the window, which the broker makes if it is paused.
+// Returns false if the simulation has already finished. Does nothing but wait when WithEdits is given.
+func (s *Simulation) Edit(edit util.Edit) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+	select {
+	case s.edits <- edit:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// Done returns a channel that is closed once the simulation has finished.
+func (s *Simulation) Done() <-chan struct{} {
+	return s.done
+}
+
+// Wait waits for the simulation to finish, and returns why it stopped early: the error of the context
+// when it was cancelled, the error reading the world or the error from the broker.
+// Returns nil when it finished normally or q or k was pressed.
+func (s *Simulation) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// Checks that the parameters describe a world that can be run, so that a mistake is returned by Start
+func checkParams(p Params) error {
+	if p.ImageWidth < 1 || p.ImageHeight < 1 {
+		return fmt.Errorf("invalid world size %dx%d", p.ImageWidth, p.ImageHeight)
+	}
+	if p.Turns < 0 {
+		return fmt.Errorf("invalid number of turns %d", p.Turns)
+	}
+	if p.Threads < 1 {
+		return fmt.Errorf("invalid number of threads %d", p.Threads)
+	}
+	if _, err := util.ParseRule(p.Rule); err != nil {
+		return err
+	}
+	return checkOutput(p)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// The glider in images/16x16.pgm, cut down to the 5x4 corner it is in
+var netpbmGlider = []util.Cell{{X: 4, Y: 1}, {X: 3, Y: 2}, {X: 4, Y: 2}, {X: 2, Y: 3}, {X: 4, Y: 3}}
+
+// TestReadImage reads the same glider from PBM and PGM images written in every variant, with comments, maxvals
+// that aren't 255 and cell bytes that are whitespace in ASCII. Broken images should give errors, and a run
+// that can't read its image should end with an ImageInputError event instead of a panic.
+func TestReadImage(t *testing.T) {
+	for name, image := range map[string]string{
+		"P1":           "P1\n# glider\n5 4\n00000\n00001\n00011\n00101\n",
+		"P1 spaced":    "P1 5 4 0 0 0 0 0 0 0 0 0 1 0 0 0 1 1 0 0 1 0 1",
+		"P2":           "P2\n5 4\n# cells\n255\n0 0 0 0 0\n0 0 0 0 255\n0 0 0 255 255\n0 0 255 0 255\n",
+		"P2 maxval":    "P2 5 4 3 1 0 0 1 0 0 0 0 0 2 0 0 1 3 2 0 1 2 0 3",
+		"P4":           "P4\n# glider\n5 4\n\x00\x08\x18\x28",
+		"P5":           "P5\n5 4\n255\n\x00\x00\x00\x00\x00\x00\x00\x00\x00\xff\x00\x00\x00\xff\xff\x00\x00\xff\x00\xff",
+		"P5 maxval 15": "P5 5 4 15 \x05\x05\x05\x05\x05\x05\x05\x05\x05\x0a\x05\x05\x05\x09\x0a\x05\x05\x0c\x05\x0d",
+		"P5 16 bit": "P5\n5 4\n# two bytes a cell\n1000\n" + strings.Repeat("\x00\x00", 9) + "\x03\xe8" + strings.Repeat("\x00\x00", 3) +
+			"\x01\xf5\x03\xe8" + strings.Repeat("\x00\x00", 2) + "\x02\x00\x00\x00\x02\x58",
+	} {
+		t.Run(name, func(t *testing.T) {
+			world, err := util.ReadNetpbm(strings.NewReader(image))
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := gol.Params{ImageWidth: 5, ImageHeight: 4}
+			if world.Width != p.ImageWidth || world.Height != p.ImageHeight {
+				t.Fatalf("expected a 5x4 world, got %dx%d", world.Width, world.Height)
+			}
+			assertEqualBoard(t, world.AliveCells(), netpbmGlider, p)
+		})
+	}
+
+	for name, test := range map[string]struct {
+		image string
+		error string
+	}{
+		"magic":     {"P6\n5 4\n255\n", "not a PBM or PGM image"},
+		"size":      {"P2\n5 x\n255\n", "expected the height"},
+		"maxval":    {"P5\n5 4\n70000\n", "invalid maxval"},
+		"short":     {"P5\n5 4\n255\n\x00\x00", "image ends after 0 of 4 rows"},
+		"plain":     {"P1\n2 2\n0 1 2 0\n", "expected 0 or 1"},
+		"too large": {"P2\n2 1\n3\n0 4\n", "more than the maxval"},
+		"huge":      {"P4 1000000000 1000000000\n", "more than 268435456 cells"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := util.ReadNetpbm(strings.NewReader(test.image)); err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Errorf("expected an error containing %q, got %v", test.error, err)
+			}
+		})
+	}
+
+	file, err := ioutil.TempFile("", "image*.pgm")
+	util.Check(err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("P2\n5 4\n255\n0 0 0 0 0\n0 0 0 0 255\n")
+	util.Check(err)
+	util.Check(file.Close())
+
+	t.Run("run", func(t *testing.T) {
+		p := gol.Params{Turns: 1, Threads: 2, ImageWidth: 5, ImageHeight: 4, Input: file.Name()}
+		events := make(chan gol.Event)
+		go gol.Run(p, events, nil)
+		var failed *gol.ImageInputError
+		for event := range events {
+			switch e := event.(type) {
+			case gol.ImageInputError:
+				failed = &e
+			case gol.FinalTurnComplete:
+				t.Fatal("expected the run to end without a FinalTurnComplete event")
+			}
+		}
+		if failed == nil || failed.Filename != file.Name() || !strings.Contains(failed.Err.Error(), "image ends after 10 of 20 cells") {
+			t.Errorf("expected an ImageInputError for the cells missing from %v, got %v", file.Name(), failed)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestNonSquare runs the 64x16 and 100x37 images, which are wider than they are tall, for 0, 1 and 100 turns
+// on numbers of threads that do and don't divide their height. The final turn and the image written to out/
+// should both match the expected images, which catches widths and heights mixed up anywhere along the way.
+func TestNonSquare(t *testing.T) {
+	for _, size := range []struct{ width, height int }{{64, 16}, {100, 37}} {
+		for _, turns := range []int{0, 1, 100} {
+			for _, threads := range []int{1, 3, 8, 16} {
+				p := gol.Params{Turns: turns, Threads: threads, ImageWidth: size.width, ImageHeight: size.height}
+				t.Run(fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+					assertNonSquare(t, p)
+				})
+			}
+		}
+	}
+}
+
+// Checks the final turn and the image written at the end of a run against the expected image
+func assertNonSquare(t *testing.T, p gol.Params) {
+	name := fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns)
+	_ = os.Remove("out/" + name)
+	expectedAlive := readAliveCells("check/images/"+name, p.ImageWidth, p.ImageHeight)
+	if !assertEqualBoard(t, runParams(p), expectedAlive, p) {
+		return
+	}
+	assertEqualBoard(t, readAliveCells("out/"+name, p.ImageWidth, p.ImageHeight), expectedAlive, p)
+}
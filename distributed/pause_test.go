@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/rpc"
+	"reflect"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestPause pauses a 512x512 world with p, checks that the broker stays on the paused turn while s and q are pressed,
+// then attaches a new controller to the paused session and resumes it with p.
+func TestPause(t *testing.T) {
+	p := gol.Params{
+		Turns:       100000000,
+		Threads:     8,
+		ImageWidth:  512,
+		ImageHeight: 512,
+	}
+	alive := readAliveCounts(p.ImageWidth, p.ImageHeight)
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune, 2)
+	go gol.Run(p, events, keyPresses)
+
+	waitForEvent(t, events, gol.AliveCellsCount{})
+	keyPresses <- 'p'
+	paused := waitForEvent(t, events, gol.StateChange{}).(gol.StateChange)
+	if paused.NewState != gol.Paused {
+		t.Fatalf("expected the Paused state after pressing p, got %v", paused.NewState)
+	}
+
+	// The broker shouldn't carry on while paused
+	if count := waitForEvent(t, events, gol.AliveCellsCount{}).(gol.AliveCellsCount); count.CompletedTurns != paused.CompletedTurns {
+		t.Errorf("paused on turn %v, but the broker got to turn %v", paused.CompletedTurns, count.CompletedTurns)
+	} else if expected := expectedAlive(alive, count.CompletedTurns); count.CellsCount != expected {
+		t.Errorf("At turn %v expected %v alive cells, got %v instead", count.CompletedTurns, expected, count.CellsCount)
+	}
+	keyPresses <- 's'
+	if output := waitForEvent(t, events, gol.ImageOutputComplete{}).(gol.ImageOutputComplete); output.CompletedTurns != paused.CompletedTurns {
+		t.Errorf("paused on turn %v, but saved the image of turn %v", paused.CompletedTurns, output.CompletedTurns)
+	}
+	keyPresses <- 'q'
+	final := waitForEvent(t, events, gol.FinalTurnComplete{}).(gol.FinalTurnComplete)
+	if final.CompletedTurns != paused.CompletedTurns {
+		t.Errorf("paused on turn %v, but quit on turn %v", paused.CompletedTurns, final.CompletedTurns)
+	}
+	for range events {
+	}
+
+	// Find the id of the session that was left paused
+	client, err := rpc.Dial("tcp", "127.0.0.1:8030")
+	util.Check(err)
+	defer client.Close()
+	response := new(stubs.Response)
+	util.Check(client.Call(stubs.AttachHandler, stubs.Request{}, response))
+	util.Check(client.Call(stubs.DetachHandler, stubs.Request{Session: response.Session}, new(stubs.Response)))
+
+	// The new controller should find the session paused, and carry on from the same turn when p is pressed
+	events = make(chan gol.Event)
+	go gol.Run(gol.Params{Session: response.Session}, events, keyPresses)
+	if state := waitForEvent(t, events, gol.StateChange{}).(gol.StateChange); state.NewState != gol.Paused || state.CompletedTurns != paused.CompletedTurns {
+		t.Errorf("expected the attached session to be paused on turn %v, got %v on turn %v", paused.CompletedTurns, state.NewState, state.CompletedTurns)
+	}
+	keyPresses <- 'p'
+	if state := waitForEvent(t, events, gol.StateChange{}).(gol.StateChange); state.NewState != gol.Executing || state.CompletedTurns != paused.CompletedTurns {
+		t.Errorf("expected the session to resume from turn %v, got %v on turn %v", paused.CompletedTurns, state.NewState, state.CompletedTurns)
+	}
+	if count := waitForEvent(t, events, gol.AliveCellsCount{}).(gol.AliveCellsCount); count.CompletedTurns <= paused.CompletedTurns {
+		t.Errorf("resumed on turn %v, but the broker is still on turn %v", paused.CompletedTurns, count.CompletedTurns)
+	}
+	keyPresses <- 'q'
+	for range events {
+	}
+}
+
+// Returns the next event of the same type as example, failing the test if the events channel is closed first
+func waitForEvent(t *testing.T, events <-chan gol.Event, example gol.Event) gol.Event {
+	for event := range events {
+		if reflect.TypeOf(event) == reflect.TypeOf(example) {
+			return event
+		}
+	}
+	t.Fatalf("events closed before a %T event was received", example)
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Runs the world through the recorder and returns the files it wrote
+func runRecorded(t *testing.T, p gol.Params) []gol.ImageOutputComplete {
+	events := make(chan gol.Event, 1000)
+	recorded, err := gol.Record(p, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go gol.Run(p, events, nil)
+	var written []gol.ImageOutputComplete
+	for event := range recorded {
+		if e, ok := event.(gol.ImageOutputComplete); ok && filepath.Dir(e.Filename) != "out" {
+			written = append(written, e)
+		}
+	}
+	return written
+}
+
+// Returns the alive cells of a recorded frame, drawn with cells of the given size in white on black
+func frameCells(frame image.Image, cellSize int) []util.Cell {
+	var cells []util.Cell
+	bounds := frame.Bounds()
+	for y := 0; y < bounds.Dy(); y += cellSize {
+		for x := 0; x < bounds.Dx(); x += cellSize {
+			if color.GrayModel.Convert(frame.At(x, y)).(color.Gray).Y == 0xff {
+				cells = append(cells, util.Cell{X: x / cellSize, Y: y / cellSize})
+			}
+		}
+	}
+	return cells
+}
+
+// TestRecord records the 16x16 image as an animated GIF of every turn and as PNG frames of turns 1 and 100,
+// checking the frames of turns 0, 1 and 100 against the expected images.
+func TestRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "record")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+
+	expected := func(p gol.Params, turn int) []util.Cell {
+		return readAliveCells(fmt.Sprintf("check/images/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turn), p.ImageWidth, p.ImageHeight)
+	}
+
+	t.Run("gif", func(t *testing.T) {
+		p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 16, ImageHeight: 16, CellSize: 2, Record: filepath.Join(dir, "glider.gif")}
+		written := runRecorded(t, p)
+		if len(written) != 1 || written[0].Filename != p.Record {
+			t.Fatalf("expected one ImageOutputComplete event for %v, got %v", p.Record, written)
+		}
+		file, err := os.Open(p.Record)
+		util.Check(err)
+		defer file.Close()
+		animation, err := gif.DecodeAll(file)
+		util.Check(err)
+		if len(animation.Image) != 101 {
+			t.Fatalf("expected 101 frames for turns 0 to 100, got %v", len(animation.Image))
+		}
+		for _, turn := range []int{0, 1, 100} {
+			assertEqualBoard(t, frameCells(animation.Image[turn], p.CellSize), expected(p, turn), p)
+		}
+	})
+
+	t.Run("png", func(t *testing.T) {
+		p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 16, ImageHeight: 16, Record: filepath.Join(dir, "frames", "glider.png"),
+			RecordFrom: 1, RecordEvery: 99}
+		written := runRecorded(t, p)
+		if len(written) != 2 {
+			t.Fatalf("expected frames of turns 1 and 100, got %v", written)
+		}
+		for i, turn := range []int{1, 100} {
+			filename := filepath.Join(dir, "frames", fmt.Sprintf("glider-%06d.png", turn))
+			if written[i].Filename != filename || written[i].CompletedTurns != turn {
+				t.Fatalf("expected turn %v to be written to %v, got %v", turn, filename, written[i])
+			}
+			file, err := os.Open(filename)
+			util.Check(err)
+			frame, err := png.Decode(file)
+			file.Close()
+			util.Check(err)
+			assertEqualBoard(t, frameCells(frame, 1), expected(p, turn), p)
+		}
+	})
+
+	for name, p := range map[string]gol.Params{
+		"format": {Record: "glider.jpg"},
+		"range":  {Record: "glider.gif", RecordFrom: 10, RecordTo: 5},
+		"stride": {Record: "glider.gif", RecordEvery: -1},
+		"colour": {Record: "glider.gif", AliveColour: "white"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := gol.Record(p, make(chan gol.Event)); err == nil {
+				t.Errorf("expected an error recording with %+v", p)
+			}
+		})
+	}
+}
@@ -2,48 +2,114 @@ package sdl
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/veandco/go-sdl2/sdl"
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
+// Range of the zoom, in pixels along each side of a cell
+const (
+	minScale = 1.0 / 64
+	maxScale = 64
+)
+
+// Distance of the overlay from the corner of the window, and the space around its text
+const (
+	overlayMargin  = 8
+	overlayPadding = 3
+)
+
+// Window shows the world with a pixel of its texture for each cell, scaled up or down to the zoom.
+// Width and Height are the size of the world, and the window itself can be any size.
 type Window struct {
 	Width, Height int32
 	window        *sdl.Window
 	renderer      *sdl.Renderer
 	texture       *sdl.Texture
 	pixels        []byte
+	// Size of the window, which can be resized
+	screenWidth, screenHeight int32
+	// Pixels along each side of a cell, and the cell in the top left corner of the window, which can be part way
+	// into a cell or outside of the world
+	scale        float64
+	viewX, viewY float64
+	minimap      *minimap
+	// Turn each cell last flipped on, for the colour modes, and the turn being shown
+	flipped []int32
+	turn    int32
+	alive   int
+	colours colourMode
+	// Pixels coloured by the colour mode, which are only worked out for the cells in view
+	coloured []byte
+	// Lines of text drawn over the top left corner of the window, such as the turn and the alive count
+	overlay []string
 }
 
 func filterEvent(e sdl.Event, userdata interface{}) bool {
-	return e.GetType() == sdl.KEYDOWN || e.GetType() == sdl.QUIT
+	switch e.GetType() {
+	case sdl.KEYDOWN, sdl.QUIT, sdl.MOUSEBUTTONDOWN, sdl.MOUSEBUTTONUP, sdl.MOUSEMOTION, sdl.MOUSEWHEEL, sdl.WINDOWEVENT:
+		return true
+	}
+	return false
 }
 
+// Creates a window for a world, zoomed so that the whole world fits on the screen
 func NewWindow(width, height int32) *Window {
+	return NewScaledWindow(width, height, 0)
+}
+
+// Creates a window for a world with cells scale pixels across, or zoomed to fit the world on the screen if scale is 0.
+// The window is only as big as the world at that scale, up to most of the screen.
+func NewScaledWindow(width, height int32, scale float64) *Window {
 	err := sdl.Init(sdl.INIT_EVERYTHING)
 	util.Check(err)
-	window, err := sdl.CreateWindow("GOL GUI", sdl.WINDOWPOS_CENTERED, sdl.WINDOWPOS_CENTERED, width, height, sdl.WINDOW_SHOWN)
+	bounds, err := sdl.GetDisplayUsableBounds(0)
 	util.Check(err)
-	renderer, err := sdl.CreateRenderer(window, -1, sdl.WINDOW_SHOWN)
+	spaceWidth, spaceHeight := float64(bounds.W)*0.9, float64(bounds.H)*0.9
+	if scale <= 0 {
+		scale = fitScale(float64(width), float64(height), spaceWidth, spaceHeight)
+	}
+	scale = math.Min(math.Max(scale, minScale), maxScale)
+	screenWidth := int32(math.Max(math.Min(float64(width)*scale, spaceWidth), 1))
+	screenHeight := int32(math.Max(math.Min(float64(height)*scale, spaceHeight), 1))
+
+	window, err := sdl.CreateWindow("GOL GUI", sdl.WINDOWPOS_CENTERED, sdl.WINDOWPOS_CENTERED, screenWidth, screenHeight, sdl.WINDOW_SHOWN|sdl.WINDOW_RESIZABLE)
 	util.Check(err)
-	sdl.SetHint(sdl.HINT_RENDER_SCALE_QUALITY, "linear")
-	err = renderer.SetLogicalSize(width, height)
+	renderer, err := sdl.CreateRenderer(window, -1, sdl.WINDOW_SHOWN)
 	util.Check(err)
+	// Cells stay sharp squares when zoomed in
+	sdl.SetHint(sdl.HINT_RENDER_SCALE_QUALITY, "nearest")
 	texture, err := renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STATIC, width, height)
 	util.Check(err)
 
 	sdl.SetEventFilterFunc(filterEvent, nil)
-	return &Window{
-		width,
-		height,
-		window,
-		renderer,
-		texture,
-		make([]byte, width*height*4),
+	w := &Window{
+		Width:        width,
+		Height:       height,
+		window:       window,
+		renderer:     renderer,
+		texture:      texture,
+		pixels:       make([]byte, width*height*4),
+		screenWidth:  screenWidth,
+		screenHeight: screenHeight,
+		scale:        scale,
+		minimap:      newMinimap(renderer, width, height),
+		flipped:      make([]int32, width*height),
 	}
+	w.ClearPixels()
+	w.centre(float64(width)/2, float64(height)/2)
+	return w
+}
+
+// Returns the largest power of two zoom that fits a world in a space
+func fitScale(width, height, spaceWidth, spaceHeight float64) float64 {
+	fit := math.Min(spaceWidth/width, spaceHeight/height)
+	return math.Min(math.Max(math.Exp2(math.Floor(math.Log2(fit))), minScale), maxScale)
 }
 
 func (w *Window) Destroy() {
+	w.minimap.destroy()
 	err := w.texture.Destroy()
 	util.Check(err)
 	err = w.renderer.Destroy()
@@ -53,22 +119,217 @@ func (w *Window) Destroy() {
 	sdl.Quit()
 }
 
+// Draws the cells in view, and the minimap when part of the world is out of view.
+// Only the cells in view are copied into the texture, so drawing a large world zoomed in costs no more than a small one.
 func (w *Window) RenderFrame() {
-	err := w.texture.Update(nil, w.pixels, int(w.Width*4))
+	// Outside of the world is grey, so that its edges can be seen
+	err := w.renderer.SetDrawColor(0x30, 0x30, 0x30, 0xFF)
 	util.Check(err)
 	err = w.renderer.Clear()
 	util.Check(err)
-	err = w.renderer.Copy(w.texture, nil, nil)
-	util.Check(err)
+	src, dst := w.visible()
+	if src.W > 0 && src.H > 0 {
+		// Dead cells are see-through
+		err = w.renderer.SetDrawColor(0, 0, 0, 0xFF)
+		util.Check(err)
+		err = w.renderer.FillRect(&dst)
+		util.Check(err)
+		pixels := w.pixels
+		if w.colours != plainColours {
+			w.colour(src)
+			pixels = w.coloured
+		}
+		err = w.texture.Update(&src, pixels[4*(src.Y*w.Width+src.X):], int(w.Width*4))
+		util.Check(err)
+		err = w.renderer.Copy(w.texture, &src, &dst)
+		util.Check(err)
+	}
+	if area, shown := w.minimapArea(); shown {
+		w.minimap.draw(w.renderer, area, src, w.Width, w.Height)
+	}
+	if len(w.overlay) > 0 {
+		w.drawOverlay()
+	}
 	w.renderer.Present()
 }
 
+// Colours the pixels of the cells in view by the colour mode
+func (w *Window) colour(src sdl.Rect) {
+	for y := src.Y; y < src.Y+src.H; y++ {
+		for x := src.X; x < src.X+src.W; x++ {
+			i := y*w.Width + x
+			r, g, b := w.colours.colour(w.pixels[4*i] == 0xFF, w.turn-w.flipped[i])
+			w.coloured[4*i+0] = b
+			w.coloured[4*i+1] = g
+			w.coloured[4*i+2] = r
+			w.coloured[4*i+3] = 0xFF
+		}
+	}
+}
+
+// Draws the lines of the overlay in the top left corner, on a dark see-through box so that they can be read over the cells
+func (w *Window) drawOverlay() {
+	size := int32(2)
+	if w.screenWidth < 400 {
+		size = 1
+	}
+	width, height := textSize(w.overlay, size)
+	err := w.renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	util.Check(err)
+	err = w.renderer.SetDrawColor(0, 0, 0, 0xB0)
+	util.Check(err)
+	err = w.renderer.FillRect(&sdl.Rect{
+		X: overlayMargin,
+		Y: overlayMargin,
+		W: width + 2*overlayPadding*size,
+		H: height + 2*overlayPadding*size,
+	})
+	util.Check(err)
+	err = w.renderer.SetDrawColor(0xFF, 0xFF, 0xFF, 0xFF)
+	util.Check(err)
+	drawText(w.renderer, w.overlay, overlayMargin+overlayPadding*size, overlayMargin+overlayPadding*size, size)
+}
+
+// Sets the lines of text shown over the world, where none hides the overlay
+func (w *Window) SetOverlay(lines []string) {
+	w.overlay = lines
+}
+
+// Sets the turn that cells flip on, which the colour modes measure the ages of cells against
+func (w *Window) SetTurn(turn int) {
+	w.turn = int32(turn)
+}
+
+// Moves on to the next way of colouring cells and returns its name
+func (w *Window) NextColours() string {
+	w.colours = (w.colours + 1) % colourModes
+	if w.colours != plainColours && w.coloured == nil {
+		w.coloured = make([]byte, len(w.pixels))
+	}
+	return w.colours.String()
+}
+
+// Returns the cells of the world that are in the window, and where they are drawn in it
+func (w *Window) visible() (src, dst sdl.Rect) {
+	left := math.Max(math.Floor(w.viewX), 0)
+	top := math.Max(math.Floor(w.viewY), 0)
+	right := math.Min(math.Ceil(w.viewX+float64(w.screenWidth)/w.scale), float64(w.Width))
+	bottom := math.Min(math.Ceil(w.viewY+float64(w.screenHeight)/w.scale), float64(w.Height))
+	if right <= left || bottom <= top {
+		return sdl.Rect{}, sdl.Rect{}
+	}
+	src = sdl.Rect{X: int32(left), Y: int32(top), W: int32(right - left), H: int32(bottom - top)}
+	x := int32(math.Floor((left - w.viewX) * w.scale))
+	y := int32(math.Floor((top - w.viewY) * w.scale))
+	dst = sdl.Rect{
+		X: x,
+		Y: y,
+		W: int32(math.Floor((right-w.viewX)*w.scale)) - x,
+		H: int32(math.Floor((bottom-w.viewY)*w.scale)) - y,
+	}
+	return src, dst
+}
+
+// Returns the cell under a point in the window, which may be outside of the world
+func (w *Window) CellAt(x, y int32) (int, int) {
+	return int(math.Floor(w.viewX + float64(x)/w.scale)), int(math.Floor(w.viewY + float64(y)/w.scale))
+}
+
+// Moves the view so that a point of the world is in the middle of the window
+func (w *Window) centre(x, y float64) {
+	w.viewX = x - float64(w.screenWidth)/w.scale/2
+	w.viewY = y - float64(w.screenHeight)/w.scale/2
+	w.clampView()
+}
+
+// Keeps the world in view. A world narrower than the window is kept in the middle of it,
+// and a wider one can't be moved past its edges.
+func (w *Window) clampView() {
+	clamp := func(view float64, world, screen int32) float64 {
+		space := float64(screen) / w.scale
+		if space >= float64(world) {
+			return (float64(world) - space) / 2
+		}
+		return math.Min(math.Max(view, 0), float64(world)-space)
+	}
+	w.viewX = clamp(w.viewX, w.Width, w.screenWidth)
+	w.viewY = clamp(w.viewY, w.Height, w.screenHeight)
+}
+
+// Multiplies the zoom by a factor, keeping the cell under a point in the window where it is
+func (w *Window) Zoom(factor float64, x, y int32) {
+	scale := math.Min(math.Max(w.scale*factor, minScale), maxScale)
+	cellX, cellY := w.viewX+float64(x)/w.scale, w.viewY+float64(y)/w.scale
+	w.scale = scale
+	w.viewX, w.viewY = cellX-float64(x)/scale, cellY-float64(y)/scale
+	w.clampView()
+}
+
+// Zooms about the middle of the window
+func (w *Window) ZoomCentre(factor float64) {
+	w.Zoom(factor, w.screenWidth/2, w.screenHeight/2)
+}
+
+// Moves the world by a number of pixels, as when it is dragged
+func (w *Window) Pan(dx, dy int32) {
+	w.viewX -= float64(dx) / w.scale
+	w.viewY -= float64(dy) / w.scale
+	w.clampView()
+}
+
+// Zooms so that the whole world fits in the window
+func (w *Window) Fit() {
+	w.scale = fitScale(float64(w.Width), float64(w.Height), float64(w.screenWidth), float64(w.screenHeight))
+	w.centre(float64(w.Width)/2, float64(w.Height)/2)
+}
+
+// Takes the new size of the window after it has been resized
+func (w *Window) Resize() {
+	w.screenWidth, w.screenHeight = w.window.GetSize()
+	w.clampView()
+}
+
+// Returns where the minimap is drawn in the corner of the window, and whether it is shown,
+// which is only when part of the world is out of view and the window is big enough to spare the room
+func (w *Window) minimapArea() (sdl.Rect, bool) {
+	src, _ := w.visible()
+	side := w.screenWidth
+	if w.screenHeight < side {
+		side = w.screenHeight
+	}
+	side /= 4
+	if side > minimapSize {
+		side = minimapSize
+	}
+	if (src.W == w.Width && src.H == w.Height) || side < 32 {
+		return sdl.Rect{}, false
+	}
+	area := w.minimap.size(side)
+	area.X, area.Y = w.screenWidth-area.W-minimapMargin, w.screenHeight-area.H-minimapMargin
+	return area, true
+}
+
+// Moves the view to the part of the world under a point on the minimap.
+// Returns false, leaving the view alone, if the point isn't on the minimap.
+func (w *Window) CentreOnMinimap(x, y int32) bool {
+	area, shown := w.minimapArea()
+	if !shown || x < area.X || y < area.Y || x >= area.X+area.W || y >= area.Y+area.H {
+		return false
+	}
+	w.centre(float64(x-area.X)*float64(w.Width)/float64(area.W), float64(y-area.Y)*float64(w.Height)/float64(area.H))
+	return true
+}
+
 func (w *Window) PollEvent() sdl.Event {
 	return sdl.PollEvent()
 }
 
 func (w *Window) SetPixel(x, y int) {
 	width := int(w.Width)
+	if w.pixels[4*(y*width+x)] != 0xFF {
+		w.minimap.add(x, y, 1)
+		w.alive++
+	}
 	w.pixels[4*(y*width+x)+0] = 0xFF
 	w.pixels[4*(y*width+x)+1] = 0xFF
 	w.pixels[4*(y*width+x)+2] = 0xFF
@@ -85,6 +346,32 @@ func (w *Window) FlipPixel(x, y int) {
 	w.pixels[4*(y*width+x)+1] = ^w.pixels[4*(y*width+x)+1]
 	w.pixels[4*(y*width+x)+2] = ^w.pixels[4*(y*width+x)+2]
 	w.pixels[4*(y*width+x)+3] = ^w.pixels[4*(y*width+x)+3]
+	if w.pixels[4*(y*width+x)] == 0xFF {
+		w.minimap.add(x, y, 1)
+		w.alive++
+	} else {
+		w.minimap.add(x, y, -1)
+		w.alive--
+	}
+	w.flipped[y*width+x] = w.turn
+}
+
+// Sets the turn the cell of a pixel last flipped on, for cells drawn with SetPixel
+func (w *Window) SetPixelFlipped(x, y, turn int) {
+	w.flipped[y*int(w.Width)+x] = int32(turn)
+}
+
+// Returns the number of alive pixels, which is kept up to date as they flip
+func (w *Window) AliveCount() int {
+	return w.alive
+}
+
+// Returns whether the pixel of a cell is showing it alive, where pixels outside of the window are dead
+func (w *Window) PixelAlive(x, y int) bool {
+	if x < 0 || y < 0 || x >= int(w.Width) || y >= int(w.Height) {
+		return false
+	}
+	return w.pixels[4*(y*int(w.Width)+x)] == 0xFF
 }
 
 func (w *Window) CountPixels() int {
@@ -101,4 +388,10 @@ func (w *Window) ClearPixels() {
 	for i := range w.pixels {
 		w.pixels[i] = 0
 	}
+	// Cells that have never flipped died long enough ago to have faded
+	for i := range w.flipped {
+		w.flipped[i] = -activityTurns
+	}
+	w.alive = 0
+	w.minimap.clear()
 }
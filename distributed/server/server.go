@@ -2,54 +2,85 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"math/rand"
 	"net"
 	"net/rpc"
 	"os"
+	"sort"
 	"sync"
 	"time"
 	"uk.ac.bris.cs/gameoflife/bStubs"
 	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
 )
 
-const alive = 255
-const dead = 0
+// How long to wait for halos from another server, shorter than the broker's timeout so that the broker blames the right server
+const haloTimeout = 5 * time.Second
 
 // Global variables to interact with other RPC call functions
 var mu sync.Mutex
-var globalWorld [][]byte
 
-// GoL logic to calculate next state for the world, that returns a 2d slice
-func calculateNextState(world [][]byte, startY, endY, ImageHeight, ImageWidth int) [][]byte {
-	// newGrid creates a new slice that will return the new world, with height that is proportionately separated with other nodes
-	height := endY - startY
-	newGrid := make([][]byte, height)
-	for i := range newGrid {
-		// Allocate each []byte within [][]byte
-		newGrid[i] = make([]byte, ImageWidth)
-	}
+// The strip of the world this server owns packed one bit per cell, kept between turns, and the strip from the turn before
+// so that halo requests from servers that are still on that turn can be answered
+var globalStrip []util.BitRow
+var previousStrip []util.BitRow
+var globalTurns int
+
+// Details of the world sent by the broker in Init
+var params bStubs.Request
+var rule util.Rule
+
+// Connections to the other worker servers, dialled the first time a halo is needed from them
+var peersMu sync.Mutex
+var peers = make(map[string]*rpc.Client)
 
-	// It computes the GoL logic for its specific slice for each thread
+// GoL logic to calculate next state for the strip, that returns the new strip packed one bit per cell
+// Rows of the world are looked up with row, which returns either a row of the strip or a halo
+func calculateNextState(row func(y int) util.BitRow, startY, endY, ImageWidth, ImageHeight int, rule util.Rule, topology util.Topology) ([]util.BitRow, int) {
+	// newGrid creates the rows of the new strip, with height that is proportionately separated with other nodes
+	newGrid := util.NewBitGrid(ImageWidth, endY-startY).Rows
+
+	aliveCells := 0
+	// It computes the GoL logic for its specific slice
 	for i := startY; i < endY; i++ {
-		for j := 0; j < ImageWidth; j++ {
-			// Counts number of neighbours for each cell
-			neighbours := countNeighbours(i, j, world, ImageHeight, ImageWidth)
-			state := world[i][j]
-			// Gol logic
-			if state == dead && neighbours == 3 {
-				newGrid[i-startY][j] = alive
-			} else if state == alive && (neighbours < 2 || neighbours > 3) {
-				newGrid[i-startY][j] = dead
-			} else {
-				newGrid[i-startY][j] = state
+		above, current, below := neighbourRow(row, i-1, ImageWidth, ImageHeight, topology), row(i), neighbourRow(row, i+1, ImageWidth, ImageHeight, topology)
+		newRow := newGrid[i-startY]
+		// Gol logic, birth and survival decided by the rule sent from the broker, 64 cells at a time
+		aliveCells += rule.NextRow(above, current, below, newRow, ImageWidth)
+
+		// The neighbours of cells on the left and right edges depend on the topology
+		for _, j := range [2]int{0, ImageWidth - 1} {
+			nextAlive := rule.Next(current.Get(j), countNeighbours(j, i, row, ImageWidth, ImageHeight, topology))
+			if nextAlive != newRow.Get(j) {
+				newRow.Set(j, nextAlive)
+				if nextAlive {
+					aliveCells++
+				} else {
+					aliveCells--
+				}
 			}
 		}
 	}
-	return newGrid
+	return newGrid, aliveCells
+}
+
+// Returns the row of neighbours at y, which may be just outside of the world
+func neighbourRow(row func(y int) util.BitRow, y, ImageWidth, ImageHeight int, topology util.Topology) util.BitRow {
+	if y >= 0 && y < ImageHeight {
+		return row(y)
+	}
+	// Beyond the top or bottom edge, build the row as the topology sees it from inside
+	outer := util.NewBitRow(ImageWidth)
+	for x := 0; x < ImageWidth; x++ {
+		c, r, inside := topology.Resolve(x, y, ImageWidth, ImageHeight)
+		outer.Set(x, inside && row(r).Get(c))
+	}
+	return outer
 }
 
 // Counts the number of neighbours for each cell/entry
-func countNeighbours(x, y int, world [][]byte, ImageHeight, ImageWidth int) int {
+func countNeighbours(x, y int, row func(y int) util.BitRow, ImageWidth, ImageHeight int, topology util.Topology) int {
 	var aliveCount = 0
 	for i := -1; i < 2; i++ {
 		for j := -1; j < 2; j++ {
@@ -57,10 +88,9 @@ func countNeighbours(x, y int, world [][]byte, ImageHeight, ImageWidth int) int
 			if i == 0 && j == 0 {
 				continue
 			}
-			// Wrap-around. Add height and width for negative values
-			r := (x + i + ImageWidth) % ImageWidth
-			c := (y + j + ImageHeight) % ImageHeight
-			if world[r][c] == alive {
+			// Find the neighbour according to the topology, wrapping around on a torus
+			c, r, inside := topology.Resolve(x+i, y+j, ImageWidth, ImageHeight)
+			if inside && row(r).Get(c) {
 				aliveCount++
 			}
 		}
@@ -68,20 +98,213 @@ func countNeighbours(x, y int, world [][]byte, ImageHeight, ImageWidth int) int
 	return aliveCount
 }
 
-// GolOperations struct for broker to interact with server/worker nodes
+// Finds the rows outside of the strip that the cells in the strip have as neighbours, according to the topology
+func haloRowsNeeded(startY, endY, ImageWidth, ImageHeight int, topology util.Topology) []int {
+	needed := make(map[int]bool)
+	addNeighbours := func(x, y int) {
+		for i := -1; i < 2; i++ {
+			for j := -1; j < 2; j++ {
+				_, r, inside := topology.Resolve(x+i, y+j, ImageWidth, ImageHeight)
+				if inside && (r < startY || r >= endY) {
+					needed[r] = true
+				}
+			}
+		}
+	}
+	// Only cells on the border of the strip can have neighbours outside of it
+	for x := 0; x < ImageWidth; x++ {
+		addNeighbours(x, startY)
+		addNeighbours(x, endY-1)
+	}
+	for y := startY; y < endY; y++ {
+		addNeighbours(0, y)
+		addNeighbours(ImageWidth-1, y)
+	}
+
+	var rows []int
+	for y := range needed {
+		rows = append(rows, y)
+	}
+	sort.Ints(rows)
+	return rows
+}
+
+// Finds the worker that owns row y, strips are split evenly between the workers in order
+func ownerOf(y, ImageHeight int, workers []string) int {
+	for i := range workers {
+		if y < (i+1)*ImageHeight/len(workers) {
+			return i
+		}
+	}
+	return len(workers) - 1
+}
+
+// Returns the connection to another worker server, dialling it if needed
+func dialPeer(address string) (*rpc.Client, error) {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+	if client, ok := peers[address]; ok {
+		return client, nil
+	}
+	client, err := rpc.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	peers[address] = client
+	return client, nil
+}
+
+// Closes a broken connection to another worker server, so that it is dialled again next time
+func forgetPeer(address string) {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+	if client, ok := peers[address]; ok {
+		client.Close()
+		delete(peers, address)
+	}
+}
+
+// Fetches the halo rows for the given turn straight from the servers that own them
+func fetchHalos(req bStubs.Request, turn int) (map[int]util.BitRow, error) {
+	// Group the rows needed by the server that owns them
+	rowsByOwner := make(map[int][]int)
+	for _, y := range haloRowsNeeded(req.StartY, req.EndY, req.Width, req.Height, req.Topology) {
+		owner := ownerOf(y, req.Height, req.Workers)
+		rowsByOwner[owner] = append(rowsByOwner[owner], y)
+	}
+
+	// Request the rows from every owner in parallel
+	halos := make(map[int]util.BitRow)
+	var haloMu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(chan error, len(rowsByOwner))
+	for owner, rows := range rowsByOwner {
+		wg.Add(1)
+		go func(address string, rows []int) {
+			defer wg.Done()
+			client, err := dialPeer(address)
+			if err != nil {
+				errs <- err
+				return
+			}
+			response := new(bStubs.Response)
+			call := client.Go(bStubs.BHaloHandler, bStubs.Request{Turns: turn, Rows: rows}, response, make(chan *rpc.Call, 1))
+			select {
+			case <-call.Done:
+				err = call.Error
+			// A server that doesn't answer has probably failed, which the broker will find out too
+			case <-time.After(haloTimeout):
+				err = fmt.Errorf("halo from %s timed out after %v", address, haloTimeout)
+			}
+			if err != nil {
+				// Errors other than ones returned by the other server mean the connection is broken
+				if _, ok := err.(rpc.ServerError); !ok {
+					forgetPeer(address)
+				}
+				errs <- err
+				return
+			}
+			haloMu.Lock()
+			for i, y := range rows {
+				halos[y] = response.World[i]
+			}
+			haloMu.Unlock()
+		}(req.Workers[owner], rows)
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return halos, nil
+}
+
+// GolOperations struct for broker and other servers to interact with this server
 type GolOperations struct{}
 
-// RPC call from broker to server/nodes to calculate next state
-func (s *GolOperations) CalculateNextWorld(req bStubs.Request, res *bStubs.Response) (err error) {
-	globalWorld = req.World
+// RPC call from broker to give this server its strip of the world, the rule and the other servers' addresses
+func (s *GolOperations) Init(req bStubs.Request, res *bStubs.Response) (err error) {
+	newRule, err := util.ParseRule(req.Rule)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	params = req
+	params.World = nil
+	rule = newRule
+	globalStrip = req.World
+	previousStrip = nil
+	globalTurns = req.Turns
+	mu.Unlock()
+	return
+}
+
+// RPC call from broker to calculate the next state of the strip, exchanging halos with the other servers
+func (s *GolOperations) Step(req bStubs.Request, res *bStubs.Response) (err error) {
+	mu.Lock()
+	turn := globalTurns
+	p := params
+	r := rule
+	strip := globalStrip
+	mu.Unlock()
+
+	// Halo rows from the other servers, at the same turn as this one
+	halos, err := fetchHalos(p, turn)
+	if err != nil {
+		return err
+	}
+	row := func(y int) util.BitRow {
+		if y >= p.StartY && y < p.EndY {
+			return strip[y-p.StartY]
+		}
+		return halos[y]
+	}
+	newStrip, aliveCells := calculateNextState(row, p.StartY, p.EndY, p.Width, p.Height, r, p.Topology)
+	if req.Diff {
+		for i := range newStrip {
+			res.Flipped = util.Flipped(res.Flipped, strip[i], newStrip[i], p.StartY+i)
+		}
+	}
 
-	// globalWorld gets new world state
 	mu.Lock()
-	globalWorld = calculateNextState(req.World, req.StartY, req.EndY, req.Height, req.Width)
+	previousStrip = globalStrip
+	globalStrip = newStrip
+	globalTurns++
+	res.Turns = globalTurns
 	mu.Unlock()
 
-	// Updates response world with the global variables
-	res.World = globalWorld
+	res.AliveCells = aliveCells
+	return
+}
+
+// RPC call from another server to fetch halo rows at a given turn
+// Strips are never changed once calculated, so the rows can be sent without copying
+func (s *GolOperations) Halo(req bStubs.Request, res *bStubs.Response) (err error) {
+	mu.Lock()
+	defer mu.Unlock()
+	// The requesting server may still be on the turn before this one
+	strip := globalStrip
+	if req.Turns == globalTurns-1 && previousStrip != nil {
+		strip = previousStrip
+	} else if req.Turns != globalTurns {
+		return fmt.Errorf("halo requested for turn %d, but server is on turn %d", req.Turns, globalTurns)
+	}
+	for _, y := range req.Rows {
+		if y < params.StartY || y >= params.EndY {
+			return fmt.Errorf("row %d is not owned by this server", y)
+		}
+		res.World = append(res.World, strip[y-params.StartY])
+	}
+	res.Turns = req.Turns
+	return
+}
+
+// RPC call from broker to fetch the current strip of the world
+func (s *GolOperations) Strip(req bStubs.Request, res *bStubs.Response) (err error) {
+	mu.Lock()
+	res.World = globalStrip
+	res.Turns = globalTurns
+	mu.Unlock()
 	return
 }
 
@@ -91,15 +314,39 @@ func (s *GolOperations) ShutServer(req stubs.Request, res *stubs.Response) (err
 	return
 }
 
+// Announces this server to the broker, retrying until the broker is up
+func register(brokerAddr, address string) {
+	for {
+		broker, err := rpc.Dial("tcp", brokerAddr)
+		if err == nil {
+			err = broker.Call(stubs.RegisterHandler, stubs.Request{Address: address}, new(stubs.Response))
+			broker.Close()
+			if err == nil {
+				fmt.Println("Registered with broker", brokerAddr, "as", address)
+				return
+			}
+		}
+		fmt.Println("Could not register with broker", brokerAddr, err)
+		time.Sleep(time.Second)
+	}
+}
+
 // Main function to setup the server and listens on port :8030
+// With -broker the server registers itself, so the broker doesn't need to be told about it
 func main() {
 	pAddr := flag.String("port", "8030", "Port to listen on")
+	brokerAddr := flag.String("broker", "", "Address of the broker to register with, e.g. 127.0.0.1:8030")
+	ip := flag.String("ip", "127.0.0.1", "IP address the broker and other servers can reach this server on")
 	flag.Parse()
 	rand.Seed(time.Now().UnixNano())
 	task := &GolOperations{}
 	rpc.Register(task)
-	listener, _ := net.Listen("tcp", ":"+*pAddr)
+	listener, err := net.Listen("tcp", ":"+*pAddr)
+	util.Check(err)
 	defer listener.Close()
 
+	if *brokerAddr != "" {
+		go register(*brokerAddr, *ip+":"+*pAddr)
+	}
 	rpc.Accept(listener)
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/rpc"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/stubs"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestSession starts a 512x512 world, quits the controller with q and attaches a new controller to the same session.
+// The world should keep running on the broker, so the new controller's alive cell counts carry on from a later turn.
+func TestSession(t *testing.T) {
+	p := gol.Params{
+		Turns:       100000000,
+		Threads:     8,
+		ImageWidth:  512,
+		ImageHeight: 512,
+	}
+	alive := readAliveCounts(p.ImageWidth, p.ImageHeight)
+	detachedTurn := runUntilQuit(t, p, alive)
+
+	// Find the id of the session that was left running
+	client, err := rpc.Dial("tcp", "127.0.0.1:8030")
+	util.Check(err)
+	defer client.Close()
+	response := new(stubs.Response)
+	util.Check(client.Call(stubs.AttachHandler, stubs.Request{}, response))
+	util.Check(client.Call(stubs.DetachHandler, stubs.Request{Session: response.Session}, new(stubs.Response)))
+
+	attachedTurn := runUntilQuit(t, gol.Params{Session: response.Session}, alive)
+	if attachedTurn <= detachedTurn {
+		t.Errorf("expected the session to carry on after turn %v, but the attached controller finished on turn %v", detachedTurn, attachedTurn)
+	}
+}
+
+// Runs a controller until it has sent two correct AliveCellsCount events, then presses q and returns the turn it finished on
+func runUntilQuit(t *testing.T, p gol.Params, alive map[int]int) int {
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune, 2)
+	go gol.Run(p, events, keyPresses)
+
+	counts := 0
+	finalTurn := -1
+	for event := range events {
+		switch e := event.(type) {
+		case gol.AliveCellsCount:
+			if expected := expectedAlive(alive, e.CompletedTurns); e.CellsCount != expected {
+				t.Fatalf("At turn %v expected %v alive cells, got %v instead", e.CompletedTurns, expected, e.CellsCount)
+			}
+			counts++
+			if counts == 2 {
+				keyPresses <- 'q'
+			}
+		case gol.FinalTurnComplete:
+			if expected := expectedAlive(alive, e.CompletedTurns); len(e.Alive) != expected {
+				t.Errorf("At turn %v expected %v alive cells in the final world, got %v instead", e.CompletedTurns, expected, len(e.Alive))
+			}
+			finalTurn = e.CompletedTurns
+		}
+	}
+	if finalTurn < 0 {
+		t.Fatal("no FinalTurnComplete event received")
+	}
+	return finalTurn
+}
+
+// Number of alive cells in the 512x512 image after the given turn, which alternates between two counts after turn 10000
+func expectedAlive(alive map[int]int, turn int) int {
+	if turn <= 10000 {
+		return alive[turn]
+	} else if turn%2 == 0 {
+		return 5565
+	}
+	return 5567
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// Waits up to a second for the number of goroutines to drop back to at most n, returning how many there are
+func waitForGoroutines(n int) int {
+	for i := 0; i < 100 && runtime.NumGoroutine() > n; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return runtime.NumGoroutine()
+}
+
+// TestSimulation starts simulations with gol.Start, checking that invalid parameters are returned as errors,
+// that q and cancelling the context both detach from a session, even when its events are no longer read,
+// that a world which can't be written is returned as an error,
+// and that none of the goroutines of a simulation are left running once it has finished.
+// The sessions detached from are short, so that they don't hold up the broker for long.
+func TestSimulation(t *testing.T) {
+	for name, p := range map[string]gol.Params{
+		"size":    {Turns: 1, Threads: 4, ImageWidth: 0, ImageHeight: 16},
+		"threads": {Turns: 1, Threads: 0, ImageWidth: 16, ImageHeight: 16},
+		"rule":    {Turns: 1, Threads: 4, ImageWidth: 16, ImageHeight: 16, Rule: "B9/S23"},
+		"format":  {Turns: 1, Threads: 4, ImageWidth: 16, ImageHeight: 16, Format: "jpg"},
+		"resume":  {Turns: 1, Threads: 4, ImageWidth: 16, ImageHeight: 16, Resume: "missing.checkpoint"},
+		"session": {Session: "missing"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if simulation, err := gol.Start(context.Background(), p); err == nil {
+				for range simulation.Events {
+				}
+				t.Errorf("expected an error starting with %+v", p)
+			}
+		})
+	}
+
+	before := runtime.NumGoroutine()
+
+	t.Run("quit", func(t *testing.T) {
+		p := gol.Params{Turns: 2000, Threads: 4, ImageWidth: 16, ImageHeight: 16}
+		simulation, err := gol.Start(context.Background(), p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		final := false
+		for event := range simulation.Events {
+			switch event.(type) {
+			case gol.TurnComplete:
+				if event.GetCompletedTurns() == 10 {
+					simulation.Press('q')
+				}
+			case gol.FinalTurnComplete:
+				final = true
+			}
+		}
+		if err := simulation.Wait(); err != nil || !final {
+			t.Errorf("expected q to finish with a FinalTurnComplete event and no error, got %v", err)
+		}
+		if simulation.Press('q') {
+			t.Error("expected a key press after the simulation finished to return false")
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		p := gol.Params{Turns: 2000, Threads: 4, ImageWidth: 16, ImageHeight: 16}
+		simulation, err := gol.Start(ctx, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for event := range simulation.Events {
+			switch event.(type) {
+			case gol.TurnComplete:
+				if event.GetCompletedTurns() == 10 {
+					cancel()
+				}
+			case gol.FinalTurnComplete:
+				t.Error("expected a cancelled simulation to finish without a FinalTurnComplete event")
+			}
+		}
+		if err := simulation.Wait(); err != context.Canceled {
+			t.Errorf("expected %v, got %v", context.Canceled, err)
+		}
+	})
+
+	t.Run("abandoned", func(t *testing.T) {
+		// The events stop being read when the context is cancelled, and are full long before then
+		ctx, cancel := context.WithCancel(context.Background())
+		p := gol.Params{Turns: 2000, Threads: 4, ImageWidth: 16, ImageHeight: 16}
+		simulation, err := gol.Start(ctx, p, gol.WithEventBuffer(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		select {
+		case <-simulation.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the simulation to finish after being cancelled")
+		}
+	})
+
+	t.Run("unwritable", func(t *testing.T) {
+		// main.go is a file, so the image can't be written into it
+		p := gol.Params{Turns: 10, Threads: 4, ImageWidth: 16, ImageHeight: 16, Output: "main.go/world"}
+		simulation, err := gol.Start(context.Background(), p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for event := range simulation.Events {
+			switch event.(type) {
+			case gol.ImageOutputComplete, gol.FinalTurnComplete:
+				t.Errorf("expected a world that couldn't be written to finish without %T", event)
+			}
+		}
+		if err := simulation.Wait(); err == nil {
+			t.Error("expected an error writing the world into main.go")
+		}
+	})
+
+	t.Run("finished", func(t *testing.T) {
+		for i := 0; i < 4; i++ {
+			p := gol.Params{Turns: 10, Threads: 8, ImageWidth: 64, ImageHeight: 64}
+			simulation, err := gol.Start(context.Background(), p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range simulation.Events {
+			}
+			if err := simulation.Wait(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	if after := waitForGoroutines(before); after > before {
+		t.Errorf("expected the simulations to leave %v goroutines running, got %v", before, after)
+	}
+}
@@ -1,21 +1,67 @@
 package stubs
 
-var TurnHandler = "Broker.CalculateNextWorld"
+import "uk.ac.bris.cs/gameoflife/util"
+
+var StartHandler = "Broker.Start"
+var AttachHandler = "Broker.Attach"
+var DetachHandler = "Broker.Detach"
+var WaitHandler = "Broker.Wait"
+var PauseHandler = "Broker.Pause"
+var ResumeHandler = "Broker.Resume"
 var AliveHandler = "Broker.CalculateAlive"
 var SnapshotHandler = "Broker.Snapshot"
 var ShutHandler = "Broker.ShutServer"
+var RegisterHandler = "Broker.Register"
+var SubscribeHandler = "Broker.Subscribe"
+var DiffsHandler = "Broker.Diffs"
+var EditHandler = "Broker.Edit"
+
+// Diff is the cells that flipped in one turn of a session
+type Diff struct {
+	Turn    int
+	Flipped []util.Cell
+	// Cells set by hand while the session was paused on Turn, sent in place of the cells flipped by a turn
+	Edit *util.Edit
+}
 
 type Response struct {
 	Turns      int
-	World      [][]byte
+	World      util.BitGrid
 	AliveCells int
+	// Session the response is about, and the details of its world when attaching
+	Session  string
+	Width    int
+	Height   int
+	Threads  int
+	Rule     string
+	Topology util.Topology
+	// Whether the session is held between turns by a pause request
+	Paused bool
+	// Subscription to the diffs of the session, the turns waiting in it, and whether some were dropped because the controller fell behind
+	Subscriber int
+	Diffs      []Diff
+	Missed     bool
 }
 
 type Request struct {
-	World   [][]byte
-	Width   int
-	Height  int
-	Turns   int
-	Kill    bool
-	Threads int
+	World    util.BitGrid
+	Width    int
+	Height   int
+	Turns    int
+	Kill     bool
+	Threads  int
+	Rule     string
+	Topology util.Topology
+	// Address a worker server can be reached on, sent when it registers with the broker
+	Address string
+	// Session on the broker the request is for, empty for the one that is running
+	// When starting a world it is the id to give the new session, empty for a random one
+	Session string
+	// Turn the world handed over is on when carrying on from a checkpoint
+	CompletedTurns int
+	// Whether starting a world should also subscribe to the diffs of every turn, and the subscription a request is for
+	Subscribe  bool
+	Subscriber int
+	// Cells to set in a paused session
+	Edit util.Edit
 }
@@ -0,0 +1,216 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// The largest number of cells on each side of a dot when zooming out
+const maxScale = 1 << 12
+
+// Lines at the bottom of the terminal that aren't part of the world
+const statusLines = 2
+
+// Half blocks for the top and bottom dots of a character, indexed by top + 2*bottom
+var halfBlocks = []rune{' ', '▀', '▄', '█'}
+
+// Bits of the braille dots of a character, indexed by [y][x] of the dot
+var brailleDots = [4][2]rune{{0x01, 0x08}, {0x02, 0x10}, {0x04, 0x20}, {0x40, 0x80}}
+
+// screen keeps the world as its events describe it, and draws the part of it in view.
+// Each character of the terminal is two dots on top of each other, or eight braille dots, and each dot is a square of cells.
+type screen struct {
+	width, height int
+	world         util.BitGrid
+
+	// Cell of the world in the top left corner of the terminal
+	x, y int
+	// Cells on each side of a dot, which zooming out doubles
+	scale   int
+	braille bool
+
+	columns, rows int
+	turn, alive   int
+	state         string
+	message       string
+}
+
+func newScreen(p gol.Params, columns, rows int) *screen {
+	s := &screen{
+		width:  p.ImageWidth,
+		height: p.ImageHeight,
+		world:  util.NewBitGrid(p.ImageWidth, p.ImageHeight),
+		scale:  1,
+		state:  gol.Executing.String(),
+	}
+	s.resize(columns, rows)
+	return s
+}
+
+// Returns whether a cell is alive, where cells outside of the world are dead
+func (s *screen) cell(x, y int) bool {
+	if x < 0 || y < 0 || x >= s.width || y >= s.height {
+		return false
+	}
+	return s.world.Rows[y].Get(x)
+}
+
+// Flips a cell, keeping count of the alive cells
+func (s *screen) flip(cell util.Cell) {
+	s.world.Rows[cell.Y].Flip(cell.X)
+	if s.world.Rows[cell.Y].Get(cell.X) {
+		s.alive++
+	} else {
+		s.alive--
+	}
+}
+
+// Returns the dots across and down each character
+func (s *screen) dots() (int, int) {
+	if s.braille {
+		return 2, 4
+	}
+	return 1, 2
+}
+
+// Returns the number of cells across and down the terminal
+func (s *screen) view() (int, int) {
+	across, down := s.dots()
+	return s.columns * across * s.scale, (s.rows - statusLines) * down * s.scale
+}
+
+// Returns whether any of the cells under a dot are alive, where the dot is counted from the top left corner of the terminal
+func (s *screen) dot(dx, dy int) bool {
+	for y := s.y + dy*s.scale; y < s.y+(dy+1)*s.scale; y++ {
+		for x := s.x + dx*s.scale; x < s.x+(dx+1)*s.scale; x++ {
+			if s.cell(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the character showing the dots at a column and row of the terminal
+func (s *screen) character(column, row int) rune {
+	if s.braille {
+		r := rune(0x2800)
+		for dy := 0; dy < 4; dy++ {
+			for dx := 0; dx < 2; dx++ {
+				if s.dot(column*2+dx, row*4+dy) {
+					r |= brailleDots[dy][dx]
+				}
+			}
+		}
+		return r
+	}
+	i := 0
+	if s.dot(column, row*2) {
+		i |= 1
+	}
+	if s.dot(column, row*2+1) {
+		i |= 2
+	}
+	return halfBlocks[i]
+}
+
+// Keeps the view inside the world, unless the world fits inside it
+func (s *screen) clamp() {
+	viewWidth, viewHeight := s.view()
+	s.x = clamp(s.x, 0, s.width-viewWidth)
+	s.y = clamp(s.y, 0, s.height-viewHeight)
+}
+
+func clamp(n, min, max int) int {
+	if n > max {
+		n = max
+	}
+	if n < min {
+		n = min
+	}
+	return n
+}
+
+// Changes the size of the terminal, returning whether it changed
+func (s *screen) resize(columns, rows int) bool {
+	if rows <= statusLines {
+		rows = statusLines + 1
+	}
+	if columns < 1 {
+		columns = 1
+	}
+	if columns == s.columns && rows == s.rows {
+		return false
+	}
+	s.columns, s.rows = columns, rows
+	s.clamp()
+	return true
+}
+
+// Moves the view by a quarter of its size in each direction
+func (s *screen) scroll(dx, dy int) {
+	viewWidth, viewHeight := s.view()
+	s.x += dx * (viewWidth/4 + 1)
+	s.y += dy * (viewHeight/4 + 1)
+	s.clamp()
+}
+
+// Changes the scale to another power of two, keeping the middle of the view where it is
+func (s *screen) zoom(scale int) {
+	scale = clamp(scale, 1, maxScale)
+	viewWidth, viewHeight := s.view()
+	middleX, middleY := s.x+viewWidth/2, s.y+viewHeight/2
+	s.scale = scale
+	viewWidth, viewHeight = s.view()
+	s.x, s.y = middleX-viewWidth/2, middleY-viewHeight/2
+	s.clamp()
+}
+
+// Zooms out until the whole world fits in the terminal
+func (s *screen) fit() {
+	s.scale = 1
+	for {
+		viewWidth, viewHeight := s.view()
+		if s.scale >= maxScale || (s.width <= viewWidth && s.height <= viewHeight) {
+			break
+		}
+		s.scale *= 2
+	}
+	s.x, s.y = 0, 0
+}
+
+// Draws the view and the status lines over what was drawn before, without clearing the terminal so that it doesn't flicker
+func (s *screen) draw(out io.Writer) {
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	across, down := s.dots()
+	for row := 0; row < s.rows-statusLines; row++ {
+		for column := 0; column < s.columns; column++ {
+			// Stop at the right edge of the world, so that where it ends can be seen
+			if s.x+column*across*s.scale >= s.width || s.y+row*down*s.scale >= s.height {
+				break
+			}
+			b.WriteRune(s.character(column, row))
+		}
+		b.WriteString("\x1b[K\r\n")
+	}
+	status := fmt.Sprintf("Turn %d  Alive %d  %s  1:%d at %d,%d  %s", s.turn, s.alive, s.state, s.scale, s.x, s.y, s.message)
+	b.WriteString(truncate(status, s.columns))
+	b.WriteString("\x1b[K\r\n")
+	b.WriteString(truncate("p pause  s save  c checkpoint  q quit  k kill  arrows scroll  +/- zoom  0 fit  b braille", s.columns))
+	b.WriteString("\x1b[K")
+	_, _ = io.WriteString(out, b.String())
+}
+
+// Cuts a line down to the width of the terminal so that it doesn't wrap
+func truncate(line string, columns int) string {
+	if utf8.RuneCountInString(line) <= columns {
+		return line
+	}
+	return string([]rune(line)[:columns])
+}
@@ -0,0 +1,209 @@
+package util
+
+import "math/bits"
+
+// BitRow is a row of the world packed one bit per cell, with the cell at x in bit x%64 of word x/64.
+// Bits beyond the width of the world are always zero.
+type BitRow []uint64
+
+// BitGrid is a world packed one bit per cell, which is how worlds are kept and sent between machines.
+// Worlds are only turned into bytes of 0 and 255 when reading and writing PGM images.
+type BitGrid struct {
+	Width  int
+	Height int
+	Rows   []BitRow
+}
+
+// NewBitRow makes a row of dead cells that is wide enough for the given width.
+func NewBitRow(width int) BitRow {
+	return make(BitRow, (width+63)/64)
+}
+
+// NewBitGrid makes a world of dead cells with the given size.
+func NewBitGrid(width, height int) BitGrid {
+	rows := make([]BitRow, height)
+	for i := range rows {
+		rows[i] = NewBitRow(width)
+	}
+	return BitGrid{Width: width, Height: height, Rows: rows}
+}
+
+// PackWorld packs a world of bytes, where 255 is alive, into a BitGrid.
+func PackWorld(world [][]byte, width, height int) BitGrid {
+	grid := NewBitGrid(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if world[y][x] == 255 {
+				grid.Rows[y].Set(x, true)
+			}
+		}
+	}
+	return grid
+}
+
+// Unpack turns the grid back into a world of bytes, with 255 for alive cells and 0 for dead ones.
+func (g BitGrid) Unpack() [][]byte {
+	world := make([][]byte, g.Height)
+	for y := range world {
+		world[y] = make([]byte, g.Width)
+		for x := range world[y] {
+			if g.Rows[y].Get(x) {
+				world[y][x] = 255
+			}
+		}
+	}
+	return world
+}
+
+// Copy returns a copy of the grid that doesn't share any rows with it.
+func (g BitGrid) Copy() BitGrid {
+	rows := make([]BitRow, len(g.Rows))
+	for i, row := range g.Rows {
+		rows[i] = append(BitRow(nil), row...)
+	}
+	return BitGrid{Width: g.Width, Height: g.Height, Rows: rows}
+}
+
+// Count returns the number of alive cells in the grid.
+func (g BitGrid) Count() int {
+	count := 0
+	for _, row := range g.Rows {
+		count += row.Count()
+	}
+	return count
+}
+
+// AliveCells returns the coordinates of every alive cell, row by row.
+func (g BitGrid) AliveCells() []Cell {
+	var cells []Cell
+	for y, row := range g.Rows {
+		cells = row.AppendCells(cells, y)
+	}
+	return cells
+}
+
+// Get returns whether the cell at x is alive.
+func (r BitRow) Get(x int) bool {
+	return r[x/64]&(1<<uint(x%64)) != 0
+}
+
+// Set makes the cell at x alive or dead.
+func (r BitRow) Set(x int, isAlive bool) {
+	if isAlive {
+		r[x/64] |= 1 << uint(x%64)
+	} else {
+		r[x/64] &^= 1 << uint(x%64)
+	}
+}
+
+// Flip swaps the cell at x between alive and dead.
+func (r BitRow) Flip(x int) {
+	r[x/64] ^= 1 << uint(x%64)
+}
+
+// Count returns the number of alive cells in the row.
+func (r BitRow) Count() int {
+	count := 0
+	for _, word := range r {
+		count += bits.OnesCount64(word)
+	}
+	return count
+}
+
+// AppendCells appends the coordinates of the alive cells in the row, which is row y of the world, to cells.
+func (r BitRow) AppendCells(cells []Cell, y int) []Cell {
+	for i, word := range r {
+		cells = AppendWord(cells, word, i*64, y)
+	}
+	return cells
+}
+
+// AppendWord appends the coordinates of the cells whose bit is set in word, which starts at cell x of row y, to cells.
+func AppendWord(cells []Cell, word uint64, x, y int) []Cell {
+	for word != 0 {
+		cells = append(cells, Cell{X: x + bits.TrailingZeros64(word), Y: y})
+		// Clear the lowest set bit
+		word &= word - 1
+	}
+	return cells
+}
+
+// Flipped appends the coordinates of the cells that differ between two versions of row y of the world to cells.
+func Flipped(cells []Cell, before, after BitRow, y int) []Cell {
+	for i := range after {
+		cells = AppendWord(cells, before[i]^after[i], i*64, y)
+	}
+	return cells
+}
+
+// NextRow works out the next state of the cells in current into next, 64 cells at a time, and returns the number alive.
+// Cells beyond the left and right edges are treated as dead, so callers fix up the edge cells for other topologies.
+func (r Rule) NextRow(above, current, below, next BitRow, width int) int {
+	count := 0
+	for i := range current {
+		next[i] = r.NextWord(above, current, below, i, width)
+		count += bits.OnesCount64(next[i])
+	}
+	return count
+}
+
+// NextWord works out the next state of the 64 cells in word i of current, in the same way as NextRow.
+func (r Rule) NextWord(above, current, below BitRow, i, width int) uint64 {
+	last := len(current) - 1
+	// Neighbours to the left of each cell come from the bits below it, carrying over from the word before
+	var carryAbove, carryCurrent, carryBelow uint64
+	if i > 0 {
+		carryAbove, carryCurrent, carryBelow = above[i-1]>>63, current[i-1]>>63, below[i-1]>>63
+	}
+	// And neighbours to the right from the bits above it, carrying over from the word after
+	var nextAbove, nextCurrent, nextBelow uint64
+	if i < last {
+		nextAbove, nextCurrent, nextBelow = above[i+1]<<63, current[i+1]<<63, below[i+1]<<63
+	}
+
+	// Add up the eight neighbours of all 64 cells at once, into a 4 bit count per cell held across s0 to s3
+	var s0, s1, s2, s3 uint64
+	for _, neighbour := range [8]uint64{
+		above[i]<<1 | carryAbove, above[i], above[i]>>1 | nextAbove,
+		current[i]<<1 | carryCurrent, current[i]>>1 | nextCurrent,
+		below[i]<<1 | carryBelow, below[i], below[i]>>1 | nextBelow,
+	} {
+		c0 := s0 & neighbour
+		s0 ^= neighbour
+		c1 := s1 & c0
+		s1 ^= c0
+		c2 := s2 & c1
+		s2 ^= c1
+		s3 |= c2
+	}
+
+	// Cells with a neighbour count in the birth or survival set
+	var birth, survive uint64
+	for n := uint(0); n <= 8; n++ {
+		if (r.Birth|r.Survive)&(1<<n) == 0 {
+			continue
+		}
+		counted := matchBit(s0, n&1) & matchBit(s1, n&2) & matchBit(s2, n&4) & matchBit(s3, n&8)
+		if r.Birth&(1<<n) != 0 {
+			birth |= counted
+		}
+		if r.Survive&(1<<n) != 0 {
+			survive |= counted
+		}
+	}
+	next := current[i]&survive | ^current[i]&birth
+
+	// Keep the bits beyond the width of the world dead
+	if i == last {
+		next &= ^uint64(0) >> uint(len(current)*64-width)
+	}
+	return next
+}
+
+// Returns the cells whose bit in word is set, if set is non-zero, or clear otherwise
+func matchBit(word uint64, set uint) uint64 {
+	if set != 0 {
+		return word
+	}
+	return ^word
+}
@@ -0,0 +1,63 @@
+package util
+
+// Edit is a change made to the world by hand while it is paused, such as cells clicked in the SDL window
+// or a pattern stamped onto it.
+type Edit struct {
+	// Cells made alive and made dead
+	Alive []Cell
+	Dead  []Cell
+}
+
+// Changes returns the cells an edit flips, given whether each cell is alive and inside the world.
+// Cells already in the state they are set to and cells outside of the world are left alone, and no cell flips twice,
+// so making the same edit again changes nothing.
+func (e Edit) Changes(isAlive func(Cell) (alive, inside bool)) []Cell {
+	var changes []Cell
+	seen := make(map[Cell]bool)
+	for _, set := range []struct {
+		cells []Cell
+		alive bool
+	}{{e.Alive, true}, {e.Dead, false}} {
+		for _, cell := range set.cells {
+			if seen[cell] {
+				continue
+			}
+			seen[cell] = true
+			if alive, inside := isAlive(cell); inside && alive != set.alive {
+				changes = append(changes, cell)
+			}
+		}
+	}
+	return changes
+}
+
+// Changes returns the cells an edit flips in a world, without flipping them.
+func (g BitGrid) Changes(e Edit) []Cell {
+	return e.Changes(func(cell Cell) (bool, bool) {
+		if cell.X < 0 || cell.Y < 0 || cell.X >= g.Width || cell.Y >= g.Height {
+			return false, false
+		}
+		return g.Rows[cell.Y].Get(cell.X), true
+	})
+}
+
+// Stamp returns an edit that puts a pattern into the world with its top left corner at the given cell,
+// making the dead cells of the pattern dead as well as its alive ones alive.
+func (p Pattern) Stamp(at Cell) Edit {
+	alive := NewBitGrid(p.Width, p.Height)
+	for _, cell := range p.Cells {
+		alive.Rows[cell.Y].Set(cell.X, true)
+	}
+	var e Edit
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			cell := Cell{X: at.X + x, Y: at.Y + y}
+			if alive.Rows[y].Get(x) {
+				e.Alive = append(e.Alive, cell)
+			} else {
+				e.Dead = append(e.Dead, cell)
+			}
+		}
+	}
+	return e
+}
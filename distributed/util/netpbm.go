@@ -0,0 +1,208 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The most cells an image can have, 16384x16384, so that a header can't ask for more memory than there is
+const maxNetpbmCells = 1 << 28
+
+// ReadImage reads the world from a PBM or PGM image.
+func ReadImage(filename string) (BitGrid, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return BitGrid{}, err
+	}
+	defer file.Close()
+
+	world, err := ReadNetpbm(file)
+	if err != nil {
+		return world, fmt.Errorf("%s: %v", filename, err)
+	}
+	return world, nil
+}
+
+// ReadNetpbm reads a world from a PBM image, where 1 is an alive cell, or from a PGM image, where cells brighter than
+// half of the maxval are alive. Images can be binary (P4 and P5) or plain (P1 and P2), have any maxval up to 65535,
+// and have # comments in their header.
+func ReadNetpbm(r io.Reader) (BitGrid, error) {
+	in := bufio.NewReader(r)
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(in, magic); err != nil || magic[0] != 'P' || magic[1] < '1' || magic[1] > '5' || magic[1] == '3' {
+		return BitGrid{}, fmt.Errorf("not a PBM or PGM image, expected it to start with P1, P2, P4 or P5")
+	}
+	kind := magic[1]
+	bitmap := kind == '1' || kind == '4'
+
+	width, err := readNetpbmNumber(in, "width")
+	if err != nil {
+		return BitGrid{}, err
+	}
+	height, err := readNetpbmNumber(in, "height")
+	if err != nil {
+		return BitGrid{}, err
+	}
+	if width <= 0 || height <= 0 {
+		return BitGrid{}, fmt.Errorf("invalid size %dx%d", width, height)
+	}
+	if width*height > maxNetpbmCells {
+		return BitGrid{}, fmt.Errorf("size %dx%d has more than %d cells", width, height, maxNetpbmCells)
+	}
+	maxval := 1
+	if !bitmap {
+		maxval, err = readNetpbmNumber(in, "maxval")
+		if err != nil {
+			return BitGrid{}, err
+		}
+		if maxval < 1 || maxval > 65535 {
+			return BitGrid{}, fmt.Errorf("invalid maxval %d, expected 1 to 65535", maxval)
+		}
+	}
+	// A single whitespace character separates the header from the cells of a binary image
+	if kind == '4' || kind == '5' {
+		if c, err := in.ReadByte(); err != nil || !isNetpbmSpace(c) {
+			return BitGrid{}, fmt.Errorf("expected whitespace after the header")
+		}
+	}
+
+	world := NewBitGrid(width, height)
+	switch kind {
+	case '1':
+		err = readPlainBitmap(in, world)
+	case '2':
+		err = readPlainGraymap(in, world, maxval)
+	case '4':
+		err = readBitmap(in, world)
+	case '5':
+		err = readGraymap(in, world, maxval)
+	}
+	return world, err
+}
+
+// Returns whether a byte is whitespace in a netpbm image
+func isNetpbmSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// Skips whitespace and comments, which run from a # to the end of the line
+func skipNetpbmSpace(in *bufio.Reader) error {
+	for {
+		c, err := in.ReadByte()
+		if err != nil {
+			return err
+		}
+		if c == '#' {
+			if _, err := in.ReadString('\n'); err != nil {
+				return err
+			}
+		} else if !isNetpbmSpace(c) {
+			return in.UnreadByte()
+		}
+	}
+}
+
+// Reads a number written in ASCII from the header or the cells of a plain image
+func readNetpbmNumber(in *bufio.Reader, name string) (int, error) {
+	if err := skipNetpbmSpace(in); err != nil {
+		return 0, fmt.Errorf("image ends before its %s", name)
+	}
+	n, digits := 0, 0
+	for {
+		c, err := in.ReadByte()
+		if err != nil || c < '0' || c > '9' {
+			if err == nil {
+				in.UnreadByte()
+			}
+			break
+		}
+		n = n*10 + int(c-'0')
+		digits++
+		if n > 1<<30 {
+			return 0, fmt.Errorf("%s is too large", name)
+		}
+	}
+	if digits == 0 {
+		c, _ := in.ReadByte()
+		return 0, fmt.Errorf("unexpected %q, expected the %s", c, name)
+	}
+	return n, nil
+}
+
+// Reads the cells of a P1 image, each a 0 or a 1 that may or may not be separated by whitespace
+func readPlainBitmap(in *bufio.Reader, world BitGrid) error {
+	for y := 0; y < world.Height; y++ {
+		for x := 0; x < world.Width; x++ {
+			if err := skipNetpbmSpace(in); err != nil {
+				return fmt.Errorf("image ends after %d of %d cells", y*world.Width+x, world.Width*world.Height)
+			}
+			c, _ := in.ReadByte()
+			if c != '0' && c != '1' {
+				return fmt.Errorf("unexpected %q at cell (%d, %d), expected 0 or 1", c, x, y)
+			}
+			world.Rows[y].Set(x, c == '1')
+		}
+	}
+	return nil
+}
+
+// Reads the cells of a P2 image, each a number up to the maxval
+func readPlainGraymap(in *bufio.Reader, world BitGrid, maxval int) error {
+	for y := 0; y < world.Height; y++ {
+		for x := 0; x < world.Width; x++ {
+			if err := skipNetpbmSpace(in); err != nil {
+				return fmt.Errorf("image ends after %d of %d cells", y*world.Width+x, world.Width*world.Height)
+			}
+			value, err := readNetpbmNumber(in, fmt.Sprintf("cell (%d, %d)", x, y))
+			if err != nil {
+				return err
+			}
+			if value > maxval {
+				return fmt.Errorf("cell (%d, %d) is %d, more than the maxval %d", x, y, value, maxval)
+			}
+			world.Rows[y].Set(x, 2*value > maxval)
+		}
+	}
+	return nil
+}
+
+// Reads the cells of a P4 image, packed eight to a byte with the first cell in the highest bit and each row starting a new byte
+func readBitmap(in *bufio.Reader, world BitGrid) error {
+	row := make([]byte, (world.Width+7)/8)
+	for y := 0; y < world.Height; y++ {
+		if _, err := io.ReadFull(in, row); err != nil {
+			return fmt.Errorf("image ends after %d of %d rows", y, world.Height)
+		}
+		for x := 0; x < world.Width; x++ {
+			world.Rows[y].Set(x, row[x/8]&(0x80>>uint(x%8)) != 0)
+		}
+	}
+	return nil
+}
+
+// Reads the cells of a P5 image, a byte each or two bytes with the most significant first when the maxval is over 255
+func readGraymap(in *bufio.Reader, world BitGrid, maxval int) error {
+	size := 1
+	if maxval > 255 {
+		size = 2
+	}
+	row := make([]byte, world.Width*size)
+	for y := 0; y < world.Height; y++ {
+		if _, err := io.ReadFull(in, row); err != nil {
+			return fmt.Errorf("image ends after %d of %d rows", y, world.Height)
+		}
+		for x := 0; x < world.Width; x++ {
+			value := int(row[x])
+			if size == 2 {
+				value = int(row[2*x])<<8 | int(row[2*x+1])
+			}
+			if value > maxval {
+				return fmt.Errorf("cell (%d, %d) is %d, more than the maxval %d", x, y, value, maxval)
+			}
+			world.Rows[y].Set(x, 2*value > maxval)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Pattern is a pattern read from an RLE or plaintext (.cells) file, the formats patterns come in on LifeWiki.
+type Pattern struct {
+	Width  int
+	Height int
+	// Rule given in the header of an RLE pattern, empty when the file doesn't give one
+	Rule  string
+	Cells []Cell
+}
+
+// IsPatternFile returns whether a file holds an RLE or plaintext pattern rather than a PGM image, going by its extension.
+func IsPatternFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".rle", ".cells":
+		return true
+	}
+	return false
+}
+
+// ReadPattern reads an RLE or plaintext pattern, going by the extension of the file.
+func ReadPattern(filename string) (Pattern, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return Pattern{}, err
+	}
+	defer file.Close()
+
+	var pattern Pattern
+	if strings.ToLower(filepath.Ext(filename)) == ".rle" {
+		pattern, err = ParseRLE(file)
+	} else {
+		pattern, err = ParsePlaintext(file)
+	}
+	if err != nil {
+		return pattern, fmt.Errorf("%s: %v", filename, err)
+	}
+	return pattern, nil
+}
+
+// ParseRLE parses a pattern in run length encoded format, such as
+//
+//	#N Glider
+//	x = 3, y = 3, rule = B3/S23
+//	bo$2bo$3o!
+//
+// where b is a dead cell, o an alive one, $ the end of a row and ! the end of the pattern, each repeated by the number before it.
+func ParseRLE(r io.Reader) (Pattern, error) {
+	var pattern Pattern
+	scanner := bufio.NewScanner(r)
+	line := 0
+	header := false
+	x, y := 0, 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if !header {
+			header = true
+			if err := parseRLEHeader(text, &pattern); err != nil {
+				return pattern, fmt.Errorf("line %d: %v", line, err)
+			}
+			continue
+		}
+
+		count := 0
+		for _, c := range text {
+			if c >= '0' && c <= '9' {
+				count = count*10 + int(c-'0')
+				continue
+			}
+			if count == 0 {
+				count = 1
+			}
+			switch c {
+			case 'b', '.':
+				x += count
+			case 'o', 'A':
+				for i := 0; i < count; i++ {
+					pattern.Cells = append(pattern.Cells, Cell{X: x + i, Y: y})
+				}
+				x += count
+			case '$':
+				x = 0
+				y += count
+			case '!':
+				return pattern, checkPatternSize(pattern)
+			case ' ', '\t':
+			default:
+				return pattern, fmt.Errorf("line %d: unexpected %q in RLE pattern", line, c)
+			}
+			count = 0
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return pattern, err
+	}
+	if !header {
+		return pattern, fmt.Errorf("missing RLE header, expected the form x = 3, y = 3")
+	}
+	// The ! at the end is sometimes left out
+	return pattern, checkPatternSize(pattern)
+}
+
+// Parses the header of an RLE pattern, which gives its size and optionally its rule
+func parseRLEHeader(text string, pattern *Pattern) error {
+	// The rule comes last and can have commas in it, such as B3/S23:T100,100
+	fields := []string{text}
+	if i := strings.Index(text, "rule"); i >= 0 {
+		fields = []string{strings.TrimSuffix(strings.TrimSpace(text[:i]), ","), text[i:]}
+	}
+	fields = append(strings.Split(fields[0], ","), fields[1:]...)
+	for _, field := range fields {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid RLE header %q, expected the form x = 3, y = 3", text)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		var err error
+		switch key {
+		case "x":
+			pattern.Width, err = strconv.Atoi(value)
+		case "y":
+			pattern.Height, err = strconv.Atoi(value)
+		case "rule":
+			// Anything after a colon describes a bounded grid such as :T100,100, which the topology flag covers instead
+			rule := strings.TrimSpace(strings.SplitN(value, ":", 2)[0])
+			_, err = ParseRule(rule)
+			pattern.Rule = rule
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s in RLE header: %v", key, err)
+		}
+	}
+	if pattern.Width < 0 || pattern.Height < 0 {
+		return fmt.Errorf("invalid RLE header %q, the size can't be negative", text)
+	}
+	return nil
+}
+
+// ParsePlaintext parses a pattern in plaintext format, such as
+//
+//	!Name: Glider
+//	.O
+//	..O
+//	OOO
+//
+// where . is a dead cell, O an alive one, and lines starting with ! are comments.
+func ParsePlaintext(r io.Reader) (Pattern, error) {
+	var pattern Pattern
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.HasPrefix(text, "!") {
+			continue
+		}
+		for x, c := range text {
+			switch c {
+			case 'O', 'o', '*':
+				pattern.Cells = append(pattern.Cells, Cell{X: x, Y: pattern.Height})
+			case '.':
+			default:
+				return pattern, fmt.Errorf("line %d: unexpected %q in plaintext pattern", line, c)
+			}
+		}
+		if len(text) > pattern.Width {
+			pattern.Width = len(text)
+		}
+		pattern.Height++
+	}
+	return pattern, scanner.Err()
+}
+
+// Checks that every alive cell of a pattern is inside the size given in its header
+func checkPatternSize(pattern Pattern) error {
+	for _, cell := range pattern.Cells {
+		if cell.X >= pattern.Width || cell.Y >= pattern.Height {
+			return fmt.Errorf("cell (%d, %d) is outside the %dx%d pattern", cell.X, cell.Y, pattern.Width, pattern.Height)
+		}
+	}
+	return nil
+}
+
+// Place returns a world of the given size with the top left corner of the pattern at offset.
+// It returns an error if the pattern doesn't fit in the world there.
+func (p Pattern) Place(width, height int, offset Cell) (BitGrid, error) {
+	if offset.X < 0 || offset.Y < 0 || offset.X+p.Width > width || offset.Y+p.Height > height {
+		return BitGrid{}, fmt.Errorf("a %dx%d pattern at (%d, %d) doesn't fit in a %dx%d world",
+			p.Width, p.Height, offset.X, offset.Y, width, height)
+	}
+	world := NewBitGrid(width, height)
+	for _, cell := range p.Cells {
+		world.Rows[offset.Y+cell.Y].Set(offset.X+cell.X, true)
+	}
+	return world, nil
+}
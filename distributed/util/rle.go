@@ -0,0 +1,68 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Longest line of runs written in an RLE pattern, as LifeWiki recommends
+const rleLineLength = 70
+
+// WriteRLE writes the grid as an RLE pattern with the given rule in its header.
+// Comments are written before the header as they are, so they should start with # such as "#C" or "#R x y".
+func WriteRLE(w io.Writer, grid BitGrid, rule Rule, comments ...string) error {
+	out := bufio.NewWriter(w)
+	for _, comment := range comments {
+		fmt.Fprintln(out, comment)
+	}
+	fmt.Fprintf(out, "x = %d, y = %d, rule = %v\n", grid.Width, grid.Height, rule)
+
+	line := 0
+	// Writes a run of count copies of tag, wrapping onto a new line when it doesn't fit
+	writeRun := func(count int, tag byte) {
+		run := string(tag)
+		if count > 1 {
+			run = strconv.Itoa(count) + run
+		}
+		if line+len(run) > rleLineLength {
+			out.WriteByte('\n')
+			line = 0
+		}
+		out.WriteString(run)
+		line += len(run)
+	}
+
+	// Rows with no alive cells are only written as part of the run of $ before the next row that has some
+	endOfRows := 0
+	for y, row := range grid.Rows {
+		if y > 0 {
+			endOfRows++
+		}
+		if row.Count() == 0 {
+			continue
+		}
+		if endOfRows > 0 {
+			writeRun(endOfRows, '$')
+			endOfRows = 0
+		}
+		// Dead cells after the last alive cell in a row are left out
+		for x := 0; x < grid.Width; {
+			isAlive := row.Get(x)
+			count := 1
+			for x+count < grid.Width && row.Get(x+count) == isAlive {
+				count++
+			}
+			if isAlive {
+				writeRun(count, 'o')
+			} else if x+count < grid.Width {
+				writeRun(count, 'b')
+			}
+			x += count
+		}
+	}
+	writeRun(1, '!')
+	out.WriteByte('\n')
+	return out.Flush()
+}
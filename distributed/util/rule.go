@@ -0,0 +1,115 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rule is a Life-like cellular automaton rule in B/S notation.
+// Bit n of Birth is set if a dead cell with n alive neighbours becomes alive,
+// bit n of Survive is set if an alive cell with n alive neighbours stays alive.
+type Rule struct {
+	Birth   uint16
+	Survive uint16
+}
+
+// Conway is the rule of Conway's Game of Life, B3/S23. It is used when no rule is given.
+var Conway = Rule{Birth: 1 << 3, Survive: 1<<2 | 1<<3}
+
+// Named rules that can be used instead of a rulestring.
+var namedRules = map[string]string{
+	"life":       "B3/S23",
+	"highlife":   "B36/S23",
+	"seeds":      "B2/S",
+	"daynight":   "B3678/S34678",
+	"maze":       "B3/S12345",
+	"mazectric":  "B3/S1234",
+	"replicator": "B1357/S1357",
+	"diamoeba":   "B35678/S5678",
+	"2x2":        "B36/S125",
+	"morley":     "B368/S245",
+}
+
+// Strips the separators from names like "Day & Night" before looking them up
+var ruleNameReplacer = strings.NewReplacer(" ", "", "&", "", "-", "", "_", "")
+
+// ParseRule parses a rulestring such as "B36/S23", the older survival first notation "23/36",
+// or one of the named rules such as "highlife". An empty string gives Conway's Game of Life.
+func ParseRule(s string) (Rule, error) {
+	rulestring := strings.ToLower(strings.TrimSpace(s))
+	if rulestring == "" {
+		return Conway, nil
+	}
+	if named, ok := namedRules[ruleNameReplacer.Replace(rulestring)]; ok {
+		rulestring = strings.ToLower(named)
+	}
+
+	// B3S23 without the slash, as RLE headers sometimes give it
+	if i := strings.Index(rulestring, "s"); strings.HasPrefix(rulestring, "b") && i > 0 && !strings.Contains(rulestring, "/") {
+		rulestring = rulestring[:i] + "/" + rulestring[i:]
+	}
+
+	parts := strings.Split(rulestring, "/")
+	if len(parts) != 2 {
+		return Rule{}, fmt.Errorf("invalid rule %q: expected the form B3/S23", s)
+	}
+
+	var birth, survive string
+	switch {
+	case strings.HasPrefix(parts[0], "b") && strings.HasPrefix(parts[1], "s"):
+		birth, survive = parts[0][1:], parts[1][1:]
+	case strings.HasPrefix(parts[0], "s") && strings.HasPrefix(parts[1], "b"):
+		survive, birth = parts[0][1:], parts[1][1:]
+	default:
+		// Survival first notation without letters, e.g. 23/3
+		survive, birth = parts[0], parts[1]
+	}
+
+	var rule Rule
+	var err error
+	if rule.Birth, err = parseCounts(birth); err != nil {
+		return Rule{}, fmt.Errorf("invalid rule %q: %v", s, err)
+	}
+	if rule.Survive, err = parseCounts(survive); err != nil {
+		return Rule{}, fmt.Errorf("invalid rule %q: %v", s, err)
+	}
+	return rule, nil
+}
+
+// Turns a list of neighbour counts such as "236" into a bit set
+func parseCounts(counts string) (uint16, error) {
+	var set uint16
+	for _, c := range counts {
+		if c < '0' || c > '8' {
+			return 0, fmt.Errorf("neighbour count %q is not between 0 and 8", c)
+		}
+		set |= 1 << uint(c-'0')
+	}
+	return set, nil
+}
+
+// Next returns whether a cell is alive in the next turn, given whether it is alive now and its number of alive neighbours.
+func (r Rule) Next(isAlive bool, neighbours int) bool {
+	if isAlive {
+		return r.Survive&(1<<uint(neighbours)) != 0
+	}
+	return r.Birth&(1<<uint(neighbours)) != 0
+}
+
+// String returns the rule in B/S notation, e.g. B3/S23
+func (r Rule) String() string {
+	var sb strings.Builder
+	sb.WriteString("B")
+	for n := 0; n <= 8; n++ {
+		if r.Birth&(1<<uint(n)) != 0 {
+			sb.WriteByte(byte('0' + n))
+		}
+	}
+	sb.WriteString("/S")
+	for n := 0; n <= 8; n++ {
+		if r.Survive&(1<<uint(n)) != 0 {
+			sb.WriteByte(byte('0' + n))
+		}
+	}
+	return sb.String()
+}
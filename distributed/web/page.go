@@ -0,0 +1,138 @@
+package web
+
+// The viewer, which draws the world on a canvas from the messages of /events and sends the keys of its buttons back.
+// The keys on the keyboard work too.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Game of Life</title>
+<style>
+	body { margin: 0; background: #222; color: #eee; font-family: sans-serif; display: flex; flex-direction: column; height: 100vh; }
+	header { padding: 8px; display: flex; gap: 8px; align-items: center; flex-wrap: wrap; }
+	#status { margin-left: 8px; font-family: monospace; }
+	main { flex: 1; display: flex; align-items: center; justify-content: center; min-height: 0; }
+	canvas { image-rendering: pixelated; image-rendering: crisp-edges; background: #000; max-width: 100%; max-height: 100%; }
+</style>
+</head>
+<body>
+<header>
+	<button data-key="p">Pause (p)</button>
+	<button data-key="s">Save (s)</button>
+	<button data-key="c">Checkpoint (c)</button>
+	<button data-key="q">Quit (q)</button>
+	<button data-key="k">Kill (k)</button>
+	<span id="status">Connecting</span>
+</header>
+<main><canvas id="world" width="1" height="1"></canvas></main>
+<script>
+const canvas = document.getElementById('world');
+const context = canvas.getContext('2d');
+const statusLine = document.getElementById('status');
+let socket, image, finished = false, changed = false;
+let turn = 0, alive = 0, state = 'Executing', text = '';
+
+function showStatus() {
+	statusLine.textContent = 'Turn ' + turn + '  Alive ' + alive + '  ' + state + (text ? '  ' + text : '');
+}
+
+// Fits the canvas in the page, at a whole number of pixels a cell when the world is small enough
+function resize() {
+	const main = document.querySelector('main');
+	const scale = Math.min(main.clientWidth / canvas.width, main.clientHeight / canvas.height);
+	const size = scale >= 1 ? Math.floor(scale) : scale;
+	canvas.style.width = canvas.width * size + 'px';
+	canvas.style.height = canvas.height * size + 'px';
+}
+
+function flip(x, y) {
+	const i = (y * canvas.width + x) * 4;
+	const value = image.data[i] ? 0 : 255;
+	image.data[i] = image.data[i + 1] = image.data[i + 2] = value;
+}
+
+function receive(m) {
+	switch (m.type) {
+	case 'world':
+		canvas.width = m.width;
+		canvas.height = m.height;
+		image = context.createImageData(m.width, m.height);
+		for (let i = 3; i < image.data.length; i += 4) {
+			image.data[i] = 255;
+		}
+		// The cells of the world are the alive ones, which start dead here
+		for (let i = 0; m.cells && i < m.cells.length; i += 2) {
+			flip(m.cells[i], m.cells[i + 1]);
+		}
+		alive = m.count;
+		state = m.state;
+		resize();
+		break;
+	case 'turn':
+		for (let i = 0; m.cells && i < m.cells.length; i += 2) {
+			flip(m.cells[i], m.cells[i + 1]);
+		}
+		alive = m.count;
+		break;
+	case 'alive':
+		alive = m.count;
+		break;
+	case 'state':
+		state = m.state;
+		break;
+	case 'message':
+		text = m.text;
+		break;
+	case 'final':
+		finished = true;
+		state = 'Finished';
+		break;
+	}
+	turn = m.turn;
+	changed = true;
+}
+
+function connect() {
+	const scheme = location.protocol === 'https:' ? 'wss://' : 'ws://';
+	socket = new WebSocket(scheme + location.host + '/events');
+	socket.onmessage = function (e) { receive(JSON.parse(e.data)); };
+	socket.onclose = function () {
+		if (finished) {
+			return;
+		}
+		// The server drops a page that falls behind, which gets the whole world again when it connects again
+		statusLine.textContent = 'Disconnected, connecting again';
+		setTimeout(connect, 1000);
+	};
+}
+
+function send(key) {
+	if (socket && socket.readyState === WebSocket.OPEN) {
+		socket.send(key);
+	}
+}
+
+function draw() {
+	if (changed && image) {
+		context.putImageData(image, 0, 0);
+		showStatus();
+		changed = false;
+	}
+	requestAnimationFrame(draw);
+}
+
+document.querySelectorAll('button').forEach(function (button) {
+	button.onclick = function () { send(button.dataset.key); };
+});
+document.onkeydown = function (e) {
+	if ('pscqk'.indexOf(e.key) >= 0 && e.key.length === 1) {
+		send(e.key);
+	}
+};
+window.onresize = resize;
+connect();
+draw();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,293 @@
+package web
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// How often the cells flipped since the last update are sent to the browsers
+const updateTime = 50 * time.Millisecond
+
+// How long the browsers have to read what is left to send once the run has finished
+const finishTime = time.Second
+
+// Messages a browser can't read fast enough are dropped along with the browser, which connects again
+const clientBuffer = 64
+
+// message is sent to the browsers as JSON. Cells are x, y pairs, all in one list to keep the messages small.
+type message struct {
+	Type   string `json:"type"`
+	Turn   int    `json:"turn"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Cells  []int  `json:"cells,omitempty"`
+	Count  int    `json:"count"`
+	State  string `json:"state,omitempty"`
+	Text   string `json:"text,omitempty"`
+}
+
+// client is a browser connected to the events, with the messages waiting to be written to it
+type client struct {
+	ws   *websocket
+	send chan []byte
+}
+
+// Server serves a viewer to browsers and streams the events of a run to them over WebSockets.
+// The buttons of the viewer send the same keys as the SDL window.
+type Server struct {
+	listener net.Listener
+	p        gol.Params
+	// Closed once the run has finished, so that keys aren't sent any more
+	done chan struct{}
+	// Writers of the browsers, which have finished once they have sent everything
+	writers sync.WaitGroup
+
+	mutex    sync.Mutex
+	clients  map[*client]bool
+	finished bool
+	// The world as the browsers last saw it
+	world util.BitGrid
+	turn  int
+	alive int
+	state string
+}
+
+// Listen starts listening for browsers on an address such as localhost:8080, so that a mistake is found before the run starts.
+// An address without a host, such as :8080, listens on every network interface.
+func Listen(address string) (*Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{listener: listener, done: make(chan struct{}), clients: make(map[*client]bool)}, nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Run serves the viewer while passing the events on to the browsers, until the final turn is complete or the events are closed.
+// An infinite plane is shown as far as the image it started from.
+func (s *Server) Run(p gol.Params, events <-chan gol.Event, keyPresses chan<- rune) {
+	s.p = p
+	s.world = util.NewBitGrid(p.ImageWidth, p.ImageHeight)
+	s.state = gol.Executing.String()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.servePage)
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		s.serveEvents(w, r, keyPresses)
+	})
+	go http.Serve(s.listener, mux)
+
+	// Flips are gathered between updates, so a cell that flips back and forth doesn't need sending
+	flipped := util.NewBitGrid(p.ImageWidth, p.ImageHeight)
+	turn := 0
+	updates := time.NewTicker(updateTime)
+	defer updates.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				s.update(flipped, turn)
+				s.finish(message{Type: "final", Turn: turn})
+				return
+			}
+			switch e := event.(type) {
+			case gol.CellFlipped:
+				if e.Cell.X >= 0 && e.Cell.Y >= 0 && e.Cell.X < p.ImageWidth && e.Cell.Y < p.ImageHeight {
+					flipped.Rows[e.Cell.Y].Flip(e.Cell.X)
+				}
+				if e.CompletedTurns > turn {
+					turn = e.CompletedTurns
+				}
+			case gol.TurnComplete:
+				turn = e.CompletedTurns
+			case gol.FinalTurnComplete:
+				s.update(flipped, e.CompletedTurns)
+				s.finish(message{Type: "final", Turn: e.CompletedTurns})
+				return
+			case gol.AliveCellsCount:
+				s.update(flipped, turn)
+				s.broadcast(message{Type: "alive", Turn: e.CompletedTurns, Count: e.CellsCount})
+			case gol.StateChange:
+				s.update(flipped, turn)
+				s.mutex.Lock()
+				s.state = e.NewState.String()
+				s.mutex.Unlock()
+				s.broadcast(message{Type: "state", Turn: e.CompletedTurns, State: e.NewState.String()})
+			default:
+				if len(event.String()) > 0 {
+					s.broadcast(message{Type: "message", Turn: event.GetCompletedTurns(), Text: event.String()})
+				}
+			}
+		case <-updates.C:
+			s.update(flipped, turn)
+		}
+	}
+}
+
+// Sends the cells flipped since the last update to the browsers and clears them, unless nothing has changed
+func (s *Server) update(flipped util.BitGrid, turn int) {
+	cells := flipped.AliveCells()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(cells) == 0 && turn == s.turn {
+		return
+	}
+	m := message{Type: "turn", Turn: turn, Cells: make([]int, 0, 2*len(cells))}
+	for _, cell := range cells {
+		s.world.Rows[cell.Y].Flip(cell.X)
+		flipped.Rows[cell.Y].Flip(cell.X)
+		if s.world.Rows[cell.Y].Get(cell.X) {
+			s.alive++
+		} else {
+			s.alive--
+		}
+		m.Cells = append(m.Cells, cell.X, cell.Y)
+	}
+	s.turn = turn
+	m.Count = s.alive
+	s.sendLocked(m)
+}
+
+// Sends a message to every browser
+func (s *Server) broadcast(m message) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sendLocked(m)
+}
+
+// Sends a message to every browser while holding the mutex. A browser that has fallen behind is disconnected,
+// and gets the whole world again when its page connects again.
+func (s *Server) sendLocked(m message) {
+	data, err := json.Marshal(m)
+	util.Check(err)
+	for c := range s.clients {
+		select {
+		case c.send <- data:
+		default:
+			delete(s.clients, c)
+			close(c.send)
+		}
+	}
+}
+
+// Sends the last message, disconnects the browsers once they have read everything and stops serving the viewer
+func (s *Server) finish(m message) {
+	s.mutex.Lock()
+	s.sendLocked(m)
+	for c := range s.clients {
+		delete(s.clients, c)
+		close(c.send)
+	}
+	s.finished = true
+	close(s.done)
+	s.mutex.Unlock()
+
+	written := make(chan struct{})
+	go func() {
+		s.writers.Wait()
+		close(written)
+	}()
+	select {
+	case <-written:
+	case <-time.After(finishTime):
+	}
+	s.listener.Close()
+}
+
+// Serves the viewer's page
+func (s *Server) servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = io.WriteString(w, page)
+}
+
+// Upgrades a browser to a WebSocket, sends it the whole world and adds it to the browsers the events are sent to.
+// Its messages are keys, which are sent to the run.
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request, keyPresses chan<- rune) {
+	ws, err := upgrade(w, r)
+	if err != nil {
+		return
+	}
+	c := &client{ws: ws, send: make(chan []byte, clientBuffer)}
+
+	s.mutex.Lock()
+	if s.finished {
+		s.mutex.Unlock()
+		ws.close()
+		return
+	}
+	cells := s.world.AliveCells()
+	m := message{Type: "world", Turn: s.turn, Width: s.p.ImageWidth, Height: s.p.ImageHeight, Cells: make([]int, 0, 2*len(cells)), Count: s.alive, State: s.state}
+	for _, cell := range cells {
+		m.Cells = append(m.Cells, cell.X, cell.Y)
+	}
+	data, err := json.Marshal(m)
+	util.Check(err)
+	c.send <- data
+	s.clients[c] = true
+	s.writers.Add(1)
+	s.mutex.Unlock()
+
+	go s.write(c)
+	s.read(c, keyPresses)
+}
+
+// Writes messages to a browser until it is disconnected, then closes its connection
+func (s *Server) write(c *client) {
+	defer s.writers.Done()
+	defer c.ws.close()
+	for data := range c.send {
+		if err := c.ws.writeFrame(opText, data); err != nil {
+			s.remove(c)
+			// Drain what is left so that nothing waits on a browser that has gone
+			for range c.send {
+			}
+			return
+		}
+	}
+}
+
+// Reads keys from a browser until it disconnects
+func (s *Server) read(c *client, keyPresses chan<- rune) {
+	defer s.remove(c)
+	for {
+		data, err := c.ws.readMessage()
+		if err != nil {
+			return
+		}
+		key := string(data)
+		switch key {
+		case "p", "s", "c", "q", "k":
+			select {
+			case keyPresses <- rune(key[0]):
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+// Stops sending messages to a browser
+func (s *Server) remove(c *client) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.clients[c] {
+		delete(s.clients, c)
+		close(c.send)
+	}
+}
@@ -0,0 +1,239 @@
+package web
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Appended to the key of a handshake before hashing it, from RFC 6455
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Opcodes of WebSocket frames
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// The largest message a browser may send, which is far more than a command needs
+const maxMessage = 1 << 16
+
+// How long writing a frame can take before the browser is given up on
+const writeTimeout = 10 * time.Second
+
+// websocket is a connection that has been upgraded from HTTP. Frames can be written from more than one goroutine.
+type websocket struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writing sync.Mutex
+	// Nothing can be written after a close frame
+	closed bool
+}
+
+// Returns whether a header holds a token in its comma separated list, ignoring case
+func headerHas(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the Sec-WebSocket-Accept header that answers the key of a handshake
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// Returns whether a handshake comes from the viewer's own page. Browsers let any page open a WebSocket to any host,
+// so without this a page on another site could send keys to the run. Clients that aren't browsers send no Origin.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// Checks the opening handshake of a WebSocket and takes over the connection from the HTTP server,
+// replying with an HTTP error if the request isn't a handshake
+func upgrade(w http.ResponseWriter, r *http.Request) (*websocket, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case r.Method != http.MethodGet:
+		http.Error(w, "expected GET", http.StatusMethodNotAllowed)
+		return nil, errors.New("handshake is not a GET")
+	case !headerHas(r.Header, "Connection", "upgrade") || !headerHas(r.Header, "Upgrade", "websocket") || key == "":
+		http.Error(w, "expected a WebSocket handshake", http.StatusBadRequest)
+		return nil, errors.New("request is not a WebSocket handshake")
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "expected WebSocket version 13", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported WebSocket version")
+	case !sameOrigin(r):
+		http.Error(w, "expected the handshake to come from the viewer's page", http.StatusForbidden)
+		return nil, errors.New("handshake from another origin")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "can't upgrade this connection", http.StatusInternalServerError)
+		return nil, errors.New("connection can't be hijacked")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := io.WriteString(conn, response); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &websocket{conn: conn, reader: buffered.Reader}, nil
+}
+
+// Writes a single unmasked frame, as a server has to
+func (ws *websocket) writeFrame(opcode byte, payload []byte) error {
+	ws.writing.Lock()
+	defer ws.writing.Unlock()
+	if ws.closed {
+		return errors.New("write after the close frame")
+	}
+	ws.closed = opcode == opClose
+
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+	_ = ws.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := ws.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := ws.conn.Write(payload)
+	return err
+}
+
+// Reads the next frame, unmasking its payload. Frames from a browser are always masked.
+func (ws *websocket) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(ws.reader, header[:]); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	if header[1]&0x80 == 0 {
+		err = errors.New("frame from the browser isn't masked")
+		return
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err = io.ReadFull(ws.reader, extended[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err = io.ReadFull(ws.reader, extended[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > maxMessage {
+		err = fmt.Errorf("frame of %d bytes is too large", length)
+		return
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(ws.reader, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.reader, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// Reads the next text or binary message, joining fragmented frames and answering pings on the way.
+// Returns io.EOF once the browser closes the connection.
+func (ws *websocket) readMessage() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case opPing:
+			if err := ws.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			// Echo the status code back to finish the closing handshake
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			_ = ws.writeFrame(opClose, payload)
+			return nil, io.EOF
+		case opText, opBinary:
+			if started {
+				return nil, errors.New("new message before the last one finished")
+			}
+			started = true
+		case opContinuation:
+			if !started {
+				return nil, errors.New("continuation without a message")
+			}
+		default:
+			return nil, fmt.Errorf("unknown opcode %#x", opcode)
+		}
+		message = append(message, payload...)
+		if len(message) > maxMessage {
+			return nil, errors.New("message is too large")
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// Sends a close frame with a normal closure status and closes the connection
+func (ws *websocket) close() {
+	_ = ws.writeFrame(opClose, []byte{0x03, 0xE8})
+	ws.conn.Close()
+}
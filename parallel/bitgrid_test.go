@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestBitGrid checks the bit-parallel next state of random rows against util.Rule.Next, cell by cell,
+// for widths either side of the 64 cells in a word and every named rule. Cells beyond the edges are dead.
+func TestBitGrid(t *testing.T) {
+	rules := []string{"life", "highlife", "seeds", "daynight", "maze", "replicator", "B012345678/S", "B/S012345678"}
+	for _, width := range []int{1, 2, 63, 64, 65, 128, 200} {
+		for _, name := range rules {
+			rule, err := util.ParseRule(name)
+			util.Check(err)
+			t.Run(fmt.Sprintf("%s-%d", name, width), func(t *testing.T) {
+				world := make([][]byte, 3)
+				for y := range world {
+					world[y] = make([]byte, width)
+					for x := range world[y] {
+						if rand.Intn(3) == 0 {
+							world[y][x] = 255
+						}
+					}
+				}
+				grid := util.PackWorld(world, width, 3)
+				if unpacked := grid.Unpack(); fmt.Sprint(unpacked) != fmt.Sprint(world) {
+					t.Fatalf("unpacking a packed world gave %v, expected %v", unpacked, world)
+				}
+
+				next := util.NewBitRow(width)
+				count := rule.NextRow(grid.Rows[0], grid.Rows[1], grid.Rows[2], next, width)
+				expectedCount := 0
+				for x := 0; x < width; x++ {
+					neighbours := 0
+					for y := 0; y < 3; y++ {
+						for i := x - 1; i <= x+1; i++ {
+							if (y != 1 || i != x) && i >= 0 && i < width && world[y][i] == 255 {
+								neighbours++
+							}
+						}
+					}
+					expected := rule.Next(world[1][x] == 255, neighbours)
+					if expected {
+						expectedCount++
+					}
+					if next.Get(x) != expected {
+						t.Errorf("cell %v with %v neighbours should be %v", x, neighbours, expected)
+					}
+				}
+				if count != expectedCount || next.Count() != expectedCount {
+					t.Errorf("expected %v alive cells, NextRow returned %v and the row has %v", expectedCount, count, next.Count())
+				}
+			})
+		}
+	}
+}
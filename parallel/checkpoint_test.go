@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestCheckpoint presses c part way through 100 turns of the 64x64 image, then resumes from the saved checkpoint
+// with a different number of threads. The checkpoint should be saved next to the images of -output,
+// and the resumed world should still finish on the expected image.
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+	p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64, Output: filepath.Join(dir, "run.pgm")}
+	expectedAlive := readAliveCells(
+		"check/images/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns),
+		p.ImageWidth,
+		p.ImageHeight,
+	)
+
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune, 1)
+	go gol.Run(p, events, keyPresses)
+	var saved gol.CheckpointComplete
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			if e.CompletedTurns == 1 {
+				keyPresses <- 'c'
+			}
+		case gol.CheckpointComplete:
+			saved = e
+		}
+	}
+	if saved.Filename == "" {
+		t.Fatal("no CheckpointComplete event received after pressing c")
+	}
+	if expected := filepath.Join(dir, fmt.Sprintf("run-%v.checkpoint", saved.CompletedTurns)); saved.Filename != expected {
+		t.Errorf("expected the checkpoint to be saved to %v, got %v", expected, saved.Filename)
+	}
+
+	checkpoint, err := util.ReadCheckpoint(saved.Filename)
+	util.Check(err)
+	if checkpoint.CompletedTurns != saved.CompletedTurns || checkpoint.Turns != p.Turns {
+		t.Errorf("expected a checkpoint of turn %v out of %v, got turn %v out of %v",
+			saved.CompletedTurns, p.Turns, checkpoint.CompletedTurns, checkpoint.Turns)
+	}
+
+	// Only the checkpoint and the number of threads are given, the rest comes from the checkpoint
+	events = make(chan gol.Event)
+	go gol.Run(gol.Params{Threads: 3, Resume: saved.Filename}, events, nil)
+	var cells []util.Cell
+	for event := range events {
+		switch e := event.(type) {
+		case gol.TurnComplete:
+			if e.CompletedTurns <= saved.CompletedTurns {
+				t.Fatalf("resumed from turn %v, but turn %v was completed again", saved.CompletedTurns, e.CompletedTurns)
+			}
+		case gol.FinalTurnComplete:
+			cells = e.Alive
+		}
+	}
+	assertEqualBoard(t, cells, expectedAlive, p)
+}
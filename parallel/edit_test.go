@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Pauses a run on turn 10, stamps a glider onto it and lets it carry on for 20 more turns before quitting.
+// Returns the world the edit made, as built up from the events, the turn it was made on and the final turn.
+func runEdited(t *testing.T, p gol.Params, edit util.Edit) (util.BitGrid, int, gol.FinalTurnComplete) {
+	simulation, err := gol.Start(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	world := util.NewBitGrid(p.ImageWidth, p.ImageHeight)
+	var edited util.BitGrid
+	var final gol.FinalTurnComplete
+	paused := -1
+	for event := range simulation.Events {
+		switch e := event.(type) {
+		case gol.CellFlipped:
+			world.Rows[e.Cell.Y].Flip(e.Cell.X)
+			if paused < 0 || edited.Rows != nil {
+				continue
+			}
+			if e.CompletedTurns != paused {
+				t.Errorf("expected the cells edited to flip on turn %v, got %v", paused, e.CompletedTurns)
+			}
+			if len(world.Changes(edit)) == 0 {
+				edited = world.Copy()
+				simulation.Press('p')
+			}
+		case gol.TurnComplete:
+			if e.CompletedTurns == 10 && paused < 0 {
+				simulation.Press('p')
+			}
+			if edited.Rows != nil && e.CompletedTurns == paused+20 {
+				simulation.Press('q')
+			}
+		case gol.StateChange:
+			if e.NewState == gol.Paused && paused < 0 {
+				paused = e.CompletedTurns
+				if len(world.Changes(edit)) == 0 {
+					t.Fatal("expected the edit to change the world")
+				}
+				simulation.Edit(edit)
+			}
+		case gol.FinalTurnComplete:
+			final = e
+		}
+	}
+	if err := simulation.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if edited.Rows == nil {
+		t.Fatal("expected the edit to be made while the run was paused")
+	}
+	return edited, paused, final
+}
+
+// TestEdit checks the cells edits flip, and stamps a glider onto paused runs with Simulation.Edit.
+// The cells should flip on the turn the run was paused on, and the run should carry on from the edited world.
+func TestEdit(t *testing.T) {
+	t.Run("changes", func(t *testing.T) {
+		world := util.NewBitGrid(8, 8)
+		world.Rows[1].Set(1, true)
+		edit := util.Edit{
+			Alive: []util.Cell{{X: 1, Y: 1}, {X: 2, Y: 2}, {X: 2, Y: 2}, {X: 8, Y: 0}},
+			Dead:  []util.Cell{{X: 1, Y: 1}, {X: 3, Y: 3}, {X: -1, Y: 0}},
+		}
+		changes := world.Changes(edit)
+		if len(changes) != 1 || changes[0] != (util.Cell{X: 2, Y: 2}) {
+			t.Fatalf("expected only 2,2 to change, got %v", changes)
+		}
+		world.Rows[2].Flip(2)
+		if changes := world.Changes(edit); len(changes) != 0 {
+			t.Errorf("expected making an edit again to change nothing, got %v", changes)
+		}
+
+		stamp := util.Pattern{Width: 3, Height: 3, Cells: glider}.Stamp(util.Cell{X: 6, Y: 6})
+		if len(stamp.Alive) != len(glider) || len(stamp.Dead) != 9-len(glider) {
+			t.Errorf("expected the stamp to set every cell of the pattern, got %+v", stamp)
+		}
+		if changes := world.Changes(stamp); len(changes) != 1 || changes[0] != (util.Cell{X: 7, Y: 6}) {
+			t.Errorf("expected only the cell of the glider inside the world to change, got %v", changes)
+		}
+	})
+
+	rule, err := util.ParseRule("")
+	util.Check(err)
+	edit := util.Pattern{Width: 3, Height: 3, Cells: glider}.Stamp(util.Cell{X: 30, Y: 30})
+	for _, engine := range []string{"parallel", "hashlife"} {
+		p := gol.Params{Turns: 1000000000, Threads: 4, ImageWidth: 64, ImageHeight: 64, Engine: engine}
+		t.Run(engine, func(t *testing.T) {
+			world, turn, final := runEdited(t, p, edit)
+			for ; turn < final.CompletedTurns; turn++ {
+				world = naiveNext(p, rule, world)
+			}
+			assertEqualBoard(t, final.Alive, world.AliveCells(), p)
+		})
+	}
+}
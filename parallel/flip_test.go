@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// Reads events until they are closed, checking that every cell flips on the turn of the TurnComplete sent after it.
+// The cells alive in the image flip before the first turn, on turn 0.
+func assertFlippedTurns(t *testing.T, events <-chan gol.Event) {
+	var pending []gol.CellFlipped
+	turn := 0
+	for event := range events {
+		switch e := event.(type) {
+		case gol.CellFlipped:
+			pending = append(pending, e)
+		case gol.TurnComplete:
+			for _, flipped := range pending {
+				if flipped.CompletedTurns != e.CompletedTurns && (turn != 0 || flipped.CompletedTurns != 0) {
+					t.Errorf("expected %v to flip on turn %v, got turn %v", flipped.Cell, e.CompletedTurns, flipped.CompletedTurns)
+					break
+				}
+			}
+			pending = pending[:0]
+			turn = e.CompletedTurns
+		}
+	}
+	if turn == 0 {
+		t.Error("no TurnComplete events received")
+	}
+}
+
+// TestCellFlipped runs the 64x64 image with each engine, checking the turn every cell flips on.
+func TestCellFlipped(t *testing.T) {
+	for _, engine := range []string{"parallel", "hashlife"} {
+		p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64, Engine: engine}
+		t.Run(engine, func(t *testing.T) {
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			assertFlippedTurns(t, events)
+		})
+	}
+}
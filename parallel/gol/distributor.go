@@ -1,6 +1,7 @@
 package gol
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"time"
@@ -8,230 +9,227 @@ import (
 )
 
 type distributorChannels struct {
-	events     chan<- Event
-	ioCommand  chan<- ioCommand
-	ioIdle     <-chan bool
-	ioFilename chan<- string
-	ioOutput   chan<- uint8
-	ioInput    <-chan uint8
-	keyPresses <-chan rune
+	events       chan<- Event
+	ioCommand    chan<- ioCommand
+	ioIdle       <-chan bool
+	ioFilename   chan<- string
+	ioTurn       chan<- int
+	ioOutput     chan<- uint8
+	ioInput      <-chan uint8
+	ioInputError <-chan error
+	// Whether each image was written
+	ioOutputError <-chan error
+	ioPlane       chan<- planeImage
+	keyPresses    <-chan rune
+	// Edits to the world, only read while it is paused
+	edits <-chan util.Edit
 }
 
 const alive = 255
 const dead = 0
 
 // distributor divides the work between workers and interacts with other goroutines.
-func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
-	c.ioCommand <- ioInput
-	// Create filename from parameters and send down the filename channel
-	filename := strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(p.ImageHeight)
-	c.ioFilename <- filename
-	// TODO: Create a 2D slice to store the world.
-	world := makeWorld(p.ImageHeight, p.ImageWidth)
-
-	// Receive image byte by byte and store in 2d world
-	for i := 0; i < p.ImageHeight; i++ {
-		for j := 0; j < p.ImageWidth; j++ {
-			val := <-c.ioInput
-			world[i][j] = val
-			// Initialises starting state of world and sent down events channel with event CellFlipped
-			if val == alive {
-				aliveCell := util.Cell{X: j, Y: i}
-				c.events <- CellFlipped{CompletedTurns: 0, Cell: aliveCell}
-			}
+// It stops early without writing the world when ctx is cancelled, returning the error of ctx.
+// An image or checkpoint that can't be written stops it early too, returning the error without a FinalTurnComplete event.
+func distributor(ctx context.Context, p Params, c distributorChannels, keyPresses <-chan rune, resumed *util.Checkpoint) error {
+	// Parse the birth and survival rule once so that workers don't have to
+	rule, err := util.ParseRule(p.Rule)
+	util.Check(err)
+
+	var world util.BitGrid
+	turn := 0
+	if resumed != nil {
+		// Carry on from the world and turn saved in the checkpoint instead of reading the image
+		world = resumed.World
+		turn = resumed.CompletedTurns
+		for _, cell := range world.AliveCells() {
+			c.events <- CellFlipped{CompletedTurns: turn, Cell: cell}
 		}
+	} else if world, err = readWorld(p, c); err != nil {
+		return inputFailed(p, c, err)
 	}
 
 	// TODO: Execute all turns of the Game of Life.
 
+	// Long-lived workers that each own a strip of the world and exchange halos with each other
+	workers := startWorkers(p, rule, world, turn, c.events)
+
 	// Ticker that ticks every 2s to count number of alive cells
 	ticker := time.NewTicker(2 * time.Second)
-	turn := 0
-	// Bool value to determine if execution is paused or running
-	pPressed := false
+	defer ticker.Stop()
+	// Ticker to save checkpoints periodically, a nil channel never ticks when checkpoints are only saved on c
+	var checkpoints <-chan time.Time
+	if p.Checkpoint > 0 {
+		checkpointTicker := time.NewTicker(p.Checkpoint)
+		defer checkpointTicker.Stop()
+		checkpoints = checkpointTicker.C
+	}
+	// Bool value to stop before all the turns are done when q is pressed
+	quit := false
+	// Error writing an image or a checkpoint, which stops the run
+	var failed error
 	// Runs for input number of turns
-	for turn < p.Turns {
-		// Creates immutable world
-		immutableWorld := makeImmutableWorld(world)
-
-		out := make([]chan [][]byte, p.Threads)
-		for i := range out {
-			out[i] = make(chan [][]byte)
-		}
-
-		var newPixelData [][]uint8
-		for i := 0; i < p.Threads; i++ {
-			go worker(p, immutableWorld, i*p.ImageHeight/p.Threads, (i+1)*p.ImageHeight/p.Threads, out[i], c, turn)
-		}
-
-		for i := 0; i < len(out); i++ {
-			newPixelData = append(newPixelData, <-out[i]...)
-		}
-
-		world = newPixelData
+	for turn < p.Turns && !quit {
+		// Every worker computes the next state of its strip, the distributor waits for all of them
+		aliveCount := stepWorkers(workers)
 		turn++
 		c.events <- TurnComplete{turn}
 
 		// Stops executing the next world state and outputs last saved world
 		// if something is received from keyPresses channel or ticker
 		select {
+		// Stops when the simulation is cancelled
+		case <-ctx.Done():
+			quit = true
 		// When ticker ticks every 2s send event to events channel
 		case <-ticker.C:
-			c.events <- AliveCellsCount{turn, len(calculateAliveCells(p, world))}
+			c.events <- AliveCellsCount{turn, aliveCount}
+		// Saves a checkpoint every p.Checkpoint
+		case <-checkpoints:
+			failed = saveCheckpoint(p, c, collectWorld(p, workers), turn)
 		// Receives keys pressed
 		case key := <-keyPresses:
 			switch key {
 			// outputs world and saves it as a file
 			case 's':
 				c.events <- StateChange{turn, Executing}
-				outImage(p, world, c, turn)
-			// quits function and outputs world and saves it
+				failed = outImage(p, collectWorld(p, workers), c, turn)
+			// saves a checkpoint that can be carried on from with -resume
+			case 'c':
+				failed = saveCheckpoint(p, c, collectWorld(p, workers), turn)
+			// quits function, the world is output and saved after the loop
 			case 'q':
 				c.events <- StateChange{turn, Quitting}
-				outImage(p, world, c, turn)
-				c.events <- FinalTurnComplete{turn, calculateAliveCells(p, world)}
+				quit = true
 			// Pauses it if p not pressed and continues if pressed
 			case 'p':
 				c.events <- StateChange{turn, Paused}
-				pPressed = true
-				for {
-					switch <-keyPresses {
-					case 'p':
-						c.events <- StateChange{turn, Executing}
-						fmt.Println("Continuing")
-						pPressed = false
-					}
-					if !pPressed {
-						break
-					}
+				edit := func(e util.Edit) {
+					editWorkers(p, workers, e, turn, c.events)
+				}
+				if waitUnpaused(ctx, keyPresses, c.edits, edit) {
+					c.events <- StateChange{turn, Executing}
+					fmt.Println("Continuing")
+				} else {
+					quit = true
 				}
 			}
 		default:
 		}
+		if failed != nil {
+			quit = true
+		}
+	}
+
+	// Gather the final world from the workers and stop them
+	world = collectWorld(p, workers)
+	stopWorkers(workers)
+	if ctx.Err() != nil {
+		c.events <- StateChange{turn, Quitting}
+		return ctx.Err()
 	}
 
 	// Create output file from filename and current turn send down the filename channel
-	outImage(p, world, c, turn)
+	if failed == nil {
+		failed = outImage(p, world, c, turn)
+	}
+	if failed != nil {
+		c.events <- StateChange{turn, Quitting}
+		return failed
+	}
 
 	// TODO: Report the final state using FinalTurnCompleteEvent.
 	// Make sure that the Io has finished any output before exiting.
 	c.ioCommand <- ioCheckIdle
 	<-c.ioIdle
 
-	c.events <- FinalTurnComplete{CompletedTurns: turn, Alive: calculateAliveCells(p, world)}
+	c.events <- FinalTurnComplete{CompletedTurns: turn, Alive: world.AliveCells()}
 	c.events <- StateChange{turn, Quitting}
-	// Close the channel to stop the SDL goroutine gracefully. Removing may cause deadlock.
-	close(c.events)
+	return nil
 }
 
-// Outputs image into ioOutput and notifies events channel that image output complete
-func outImage(p Params, world [][]byte, c distributorChannels, turn int) {
-	// Sets command to output
-	c.ioCommand <- ioOutput
-	outfile := strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + "x" + strconv.Itoa(turn)
-	// Write file name
-	c.ioFilename <- outfile
-	// Outputs file byte by byte
-	for i := 0; i < p.ImageHeight; i++ {
-		for j := 0; j < p.ImageWidth; j++ {
-			c.ioOutput <- world[i][j]
+// Waits for p to be pressed again to carry on after a pause, returning false if ctx is cancelled first
+// Edits are made to the world in the meantime
+func waitUnpaused(ctx context.Context, keyPresses <-chan rune, edits <-chan util.Edit, edit func(util.Edit)) bool {
+	for {
+		select {
+		case key := <-keyPresses:
+			if key == 'p' {
+				return true
+			}
+		case e := <-edits:
+			edit(e)
+		case <-ctx.Done():
+			return false
 		}
 	}
-	// Notify events channel that image output done, with relavant turns and filename
-	c.events <- ImageOutputComplete{turn, outfile}
-}
-
-// makeMatrix makes and returns a 2D slice with the given dimensions.
-func makeWorld(height, width int) [][]byte {
-	matrix := make([][]byte, height)
-	for i := range matrix {
-		matrix[i] = make([]byte, width)
-	}
-	return matrix
 }
 
-// creates an Immutable world
-func makeImmutableWorld(world [][]byte) func(y, x int) byte {
-	return func(y, x int) byte {
-		return world[y][x]
+// Reads the input image from io into a new world packed one bit per cell, sending a CellFlipped event for every alive cell
+// Returns the error from io if the image couldn't be read
+func readWorld(p Params, c distributorChannels) (util.BitGrid, error) {
+	c.ioCommand <- ioInput
+	c.ioFilename <- inputFilename(p)
+	if err := <-c.ioInputError; err != nil {
+		return util.BitGrid{}, err
 	}
-}
-
-// Worker function to distribute the execution to multiple threads using go routines, returns output using channels
-func worker(p Params, immutableWorld func(y, x int) byte, startY int, endY int, tempWorld chan<- [][]uint8, c distributorChannels, turn int) {
-	calculatedSlice := calculateNextState(p, immutableWorld, startY, endY, c, turn)
-	tempWorld <- calculatedSlice
-}
+	// TODO: Create a 2D slice to store the world.
+	world := util.NewBitGrid(p.ImageWidth, p.ImageHeight)
 
-// GoL logic to calculate next state for the world, that returns a 2d slice
-func calculateNextState(p Params, immutableWorld func(y, x int) byte, startY int, endY int, c distributorChannels, turn int) [][]byte {
-	// newGrid creates a new slice that will return the new world, with height that is proportionately separated with other nodes
-	height := endY - startY
-	newGrid := make([][]byte, height)
-	for i := range newGrid {
-		// Allocate each []byte within [][]byte
-		newGrid[i] = make([]byte, p.ImageWidth)
-	}
-	// Calculate world in current slice.
-	// Compare the cell with the one in the old world
-	for i := startY; i < endY; i++ {
+	// Receive image byte by byte and store in 2d world
+	for i := 0; i < p.ImageHeight; i++ {
 		for j := 0; j < p.ImageWidth; j++ {
-			// Counts number of neighbours for each cell
-			neighbors := countNeighbours(p, j, i, immutableWorld)
-			if immutableWorld(i, j) == alive {
-				if neighbors == 2 || neighbors == 3 {
-					newGrid[i-startY][j] = alive
-				} else {
-					newGrid[i-startY][j] = dead
-					c.events <- CellFlipped{CompletedTurns: turn, Cell: util.Cell{X: j, Y: i}}
-				}
-			}
-
-			if immutableWorld(i, j) == dead {
-				if neighbors == 3 {
-					newGrid[i-startY][j] = alive
-					c.events <- CellFlipped{CompletedTurns: turn, Cell: util.Cell{X: j, Y: i}}
-				} else {
-					newGrid[i-startY][j] = dead
-				}
+			val := <-c.ioInput
+			world.Rows[i].Set(j, val == alive)
+			// Initialises starting state of world and sent down events channel with event CellFlipped
+			if val == alive {
+				aliveCell := util.Cell{X: j, Y: i}
+				c.events <- CellFlipped{CompletedTurns: 0, Cell: aliveCell}
 			}
 		}
 	}
-	return newGrid
+	return world, nil
 }
 
-// Counts the number of neighbours for each cell/entry
-func countNeighbours(p Params, x, y int, immutableWorld func(y, x int) byte) int {
-	var aliveCount = 0
-	for i := -1; i < 2; i++ {
-		for j := -1; j < 2; j++ {
-			// Don't count self as neighbour
-			if i == 0 && j == 0 {
-				continue
-			}
-			// Wraparound. Add height and width for negative values
-			r := (x + i + p.ImageWidth) % p.ImageWidth
-			c := (y + j + p.ImageHeight) % p.ImageHeight
-			if immutableWorld(c, r) == alive {
-				aliveCount++
-			}
-		}
+// Reports that the world couldn't be read, which ends the run before its first turn without a FinalTurnComplete event
+func inputFailed(p Params, c distributorChannels, err error) error {
+	c.events <- ImageInputError{CompletedTurns: 0, Filename: inputFilename(p), Err: err}
+	c.events <- StateChange{0, Quitting}
+	return err
+}
+
+// Returns the file the world is read from, which is the image named after the size of the world unless another one is given
+func inputFilename(p Params) string {
+	if p.Input != "" {
+		return p.Input
 	}
-	return aliveCount
+	return "images/" + strconv.Itoa(p.ImageWidth) + "x" + strconv.Itoa(p.ImageHeight) + ".pgm"
 }
 
-// Calculates number of alive cells in the world after each iteration, it returns a slice with type util.Cell
-func calculateAliveCells(p Params, world [][]byte) []util.Cell {
-	var aliveCells []util.Cell
-	// Iterate through every cell and count number of alive cells to update
+// Outputs image into ioOutput and notifies events channel that image output complete
+// The world is only turned back into bytes here, as PGM images have a byte per cell
+// Returns the error from io if the image couldn't be written
+func outImage(p Params, world util.BitGrid, c distributorChannels, turn int) error {
+	// Sets command to output
+	c.ioCommand <- ioOutput
+	outfile := outputFilename(p, turn)
+	// Write file name and the turn of the image
+	c.ioFilename <- outfile
+	c.ioTurn <- turn
+	// Outputs file byte by byte
 	for i := 0; i < p.ImageHeight; i++ {
 		for j := 0; j < p.ImageWidth; j++ {
-			// If cell is alive add it to slice of alive cells with coordinates
-			if world[i][j] == alive {
-				newCell := util.Cell{X: j, Y: i}
-				aliveCells = append(aliveCells, newCell)
+			if world.Rows[i].Get(j) {
+				c.ioOutput <- alive
+			} else {
+				c.ioOutput <- dead
 			}
 		}
 	}
-	return aliveCells
+	if err := <-c.ioOutputError; err != nil {
+		return err
+	}
+	// Notify events channel that image output done, with relavant turns and filename
+	c.events <- ImageOutputComplete{turn, outfile}
+	return nil
 }
@@ -0,0 +1,349 @@
+package gol
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Number of nodes kept before the memoised nodes are thrown away and built again from the current world
+const maxHashNodes = 1 << 21
+
+// hashNode is a square of 2^level cells in the quadtree, made of four squares of half the size.
+// Nodes are shared between every place the same square appears, so each one is only ever calculated once.
+type hashNode struct {
+	level          uint
+	nw, ne, sw, se *hashNode
+	// Whether the cell is alive, for nodes of level 0
+	alive bool
+	// Whether every cell in the square is dead
+	empty bool
+	// The centre of the square after 2^s generations, for every s calculated so far
+	results []hashResult
+}
+
+// hashResult is the centre of a node after 2^s generations.
+type hashResult struct {
+	s    uint
+	node *hashNode
+}
+
+// hashLife is a memoised quadtree of the world, which can work out the world any power of two generations ahead.
+type hashLife struct {
+	rule  util.Rule
+	nodes map[[4]*hashNode]*hashNode
+	dead  *hashNode
+	live  *hashNode
+}
+
+// Makes an empty quadtree for the given rule
+func newHashLife(rule util.Rule) *hashLife {
+	return &hashLife{
+		rule:  rule,
+		nodes: make(map[[4]*hashNode]*hashNode),
+		dead:  &hashNode{empty: true},
+		live:  &hashNode{alive: true},
+	}
+}
+
+// Returns the node made of the four given quarters, which are one level below it
+func (h *hashLife) join(nw, ne, sw, se *hashNode) *hashNode {
+	key := [4]*hashNode{nw, ne, sw, se}
+	if n, ok := h.nodes[key]; ok {
+		return n
+	}
+	n := &hashNode{
+		level: nw.level + 1,
+		nw:    nw, ne: ne, sw: sw, se: se,
+		empty: nw.empty && ne.empty && sw.empty && se.empty,
+	}
+	h.nodes[key] = n
+	return n
+}
+
+// Returns the square of half the size in the middle of a node
+func (h *hashLife) centre(n *hashNode) *hashNode {
+	return h.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw)
+}
+
+// Returns the centre of a node of level L after 2^s generations, where s is at most L-2
+// The centre is half the size of the node, as cells further out depend on cells beyond the node
+func (h *hashLife) step(n *hashNode, s uint) *hashNode {
+	for _, result := range n.results {
+		if result.s == s {
+			return result.node
+		}
+	}
+
+	var result *hashNode
+	if n.level == 2 {
+		result = h.stepSmall(n)
+	} else {
+		// The nine overlapping squares of half the size that cover the node
+		n00, n01, n02 := n.nw, h.join(n.nw.ne, n.ne.nw, n.nw.se, n.ne.sw), n.ne
+		n10, n11, n12 := h.join(n.nw.sw, n.nw.se, n.sw.nw, n.sw.ne), h.centre(n), h.join(n.ne.sw, n.ne.se, n.se.nw, n.se.ne)
+		n20, n21, n22 := n.sw, h.join(n.sw.ne, n.se.nw, n.sw.se, n.se.sw), n.se
+
+		// At full speed each square is moved on by half the generations, and again when they are put back together
+		// Otherwise the squares are only cut down to their centres, and all the generations happen when put together
+		full := s == n.level-2
+		remaining := s
+		if full {
+			remaining = s - 1
+		}
+		var r [9]*hashNode
+		for i, square := range [9]*hashNode{n00, n01, n02, n10, n11, n12, n20, n21, n22} {
+			if full {
+				r[i] = h.step(square, remaining)
+			} else {
+				r[i] = h.centre(square)
+			}
+		}
+		result = h.join(
+			h.step(h.join(r[0], r[1], r[3], r[4]), remaining),
+			h.step(h.join(r[1], r[2], r[4], r[5]), remaining),
+			h.step(h.join(r[3], r[4], r[6], r[7]), remaining),
+			h.step(h.join(r[4], r[5], r[7], r[8]), remaining),
+		)
+	}
+	n.results = append(n.results, hashResult{s, result})
+	return result
+}
+
+// Returns the middle 2x2 cells of a 4x4 node after one generation, using the rule
+func (h *hashLife) stepSmall(n *hashNode) *hashNode {
+	var cells [4][4]bool
+	for i, quarter := range [4]*hashNode{n.nw, n.ne, n.sw, n.se} {
+		x, y := i%2*2, i/2*2
+		cells[y][x], cells[y][x+1] = quarter.nw.alive, quarter.ne.alive
+		cells[y+1][x], cells[y+1][x+1] = quarter.sw.alive, quarter.se.alive
+	}
+	next := func(x, y int) *hashNode {
+		neighbours := 0
+		for j := y - 1; j <= y+1; j++ {
+			for i := x - 1; i <= x+1; i++ {
+				if (i != x || j != y) && cells[j][i] {
+					neighbours++
+				}
+			}
+		}
+		if h.rule.Next(cells[y][x], neighbours) {
+			return h.live
+		}
+		return h.dead
+	}
+	return h.join(next(1, 1), next(2, 1), next(1, 2), next(2, 2))
+}
+
+// Returns a node of the given level covered in copies of the square t
+func (h *hashLife) tile(t *hashNode, level uint) *hashNode {
+	if level == t.level {
+		return t
+	}
+	quarter := h.tile(t, level-1)
+	return h.join(quarter, quarter, quarter, quarter)
+}
+
+// Moves a torus whose size is a power of two on by 2^s generations
+// The torus is the same as the infinite plane covered in copies of it, so the centre of a large enough
+// covering moved on by 2^s generations is the torus again, shifted by the distance from the edge to the centre
+func (h *hashLife) advance(torus *hashNode, s uint) *hashNode {
+	level := torus.level + 1
+	if s+2 > level {
+		level = s + 2
+	}
+	result := h.step(h.tile(torus, level), s)
+	if level-2 >= torus.level {
+		// The centre starts a whole number of tori from the edge
+		for result.level > torus.level {
+			result = result.nw
+		}
+		return result
+	}
+	// The centre starts half a torus from the edge, so swap the quarters back into place
+	return h.join(result.se, result.sw, result.ne, result.nw)
+}
+
+// Builds a square torus of 2^level cells covered in copies of the world
+func (h *hashLife) fromGrid(world util.BitGrid, level uint, x, y int) *hashNode {
+	if level == 0 {
+		if world.Rows[y%world.Height].Get(x % world.Width) {
+			return h.live
+		}
+		return h.dead
+	}
+	half := 1 << (level - 1)
+	return h.join(
+		h.fromGrid(world, level-1, x, y),
+		h.fromGrid(world, level-1, x+half, y),
+		h.fromGrid(world, level-1, x, y+half),
+		h.fromGrid(world, level-1, x+half, y+half),
+	)
+}
+
+// Writes the cells of a node whose top left corner is at x, y into the world, leaving out those beyond its edges
+func (h *hashLife) toGrid(n *hashNode, world util.BitGrid, x, y int) {
+	if n.empty || x >= world.Width || y >= world.Height {
+		return
+	}
+	if n.level == 0 {
+		world.Rows[y].Set(x, true)
+		return
+	}
+	half := 1 << (n.level - 1)
+	h.toGrid(n.nw, world, x, y)
+	h.toGrid(n.ne, world, x+half, y)
+	h.toGrid(n.sw, world, x, y+half)
+	h.toGrid(n.se, world, x+half, y+half)
+}
+
+// Returns the level of the smallest square torus that is covered by whole copies of a world of the given size,
+// or an error if the world can't be run by the hashlife engine
+func hashLifeLevel(p Params) (uint, error) {
+	isPowerOfTwo := func(n int) bool { return n > 0 && n&(n-1) == 0 }
+	if p.Topology != util.Torus || !isPowerOfTwo(p.ImageWidth) || !isPowerOfTwo(p.ImageHeight) {
+		return 0, fmt.Errorf("the hashlife engine needs a torus with sides that are powers of two, not a %vx%v %v",
+			p.ImageWidth, p.ImageHeight, p.Topology)
+	}
+	level := uint(0)
+	for 1<<level < p.ImageWidth || 1<<level < p.ImageHeight {
+		level++
+	}
+	return level, nil
+}
+
+// hashLifeDistributor runs the world with the hashlife engine instead of workers, and interacts with other goroutines.
+// With p.Jump it moves on by the largest power of two generations left, otherwise it goes one turn at a time
+// and sends CellFlipped and TurnComplete events like the distributor.
+func hashLifeDistributor(ctx context.Context, p Params, c distributorChannels, keyPresses <-chan rune, resumed *util.Checkpoint) error {
+	rule, err := util.ParseRule(p.Rule)
+	util.Check(err)
+	level, err := hashLifeLevel(p)
+	util.Check(err)
+
+	var world util.BitGrid
+	turn := 0
+	if resumed != nil {
+		world = resumed.World
+		turn = resumed.CompletedTurns
+		for _, cell := range world.AliveCells() {
+			c.events <- CellFlipped{CompletedTurns: turn, Cell: cell}
+		}
+	} else if world, err = readWorld(p, c); err != nil {
+		return inputFailed(p, c, err)
+	}
+	h := newHashLife(rule)
+	torus := h.fromGrid(world, level, 0, 0)
+
+	// Returns the world the torus is on now
+	currentWorld := func() util.BitGrid {
+		next := util.NewBitGrid(p.ImageWidth, p.ImageHeight)
+		h.toGrid(torus, next, 0, 0)
+		return next
+	}
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	var checkpoints <-chan time.Time
+	if p.Checkpoint > 0 {
+		checkpointTicker := time.NewTicker(p.Checkpoint)
+		defer checkpointTicker.Stop()
+		checkpoints = checkpointTicker.C
+	}
+	quit := false
+	// Error writing an image or a checkpoint, which stops the run
+	var failed error
+	for turn < p.Turns && !quit {
+		if p.Jump {
+			// The largest power of two generations that doesn't go past the last turn
+			s := uint(0)
+			for s < 62 && turn+1<<(s+1) <= p.Turns {
+				s++
+			}
+			torus = h.advance(torus, s)
+			turn += 1 << s
+		} else {
+			torus = h.advance(torus, 0)
+			turn++
+			next := currentWorld()
+			for y := range next.Rows {
+				for _, cell := range util.Flipped(nil, world.Rows[y], next.Rows[y], y) {
+					c.events <- CellFlipped{CompletedTurns: turn, Cell: cell}
+				}
+			}
+			world = next
+			c.events <- TurnComplete{turn}
+		}
+
+		// The memoised nodes are rebuilt from the world once there are too many of them
+		if len(h.nodes) > maxHashNodes {
+			world = currentWorld()
+			h = newHashLife(rule)
+			torus = h.fromGrid(world, level, 0, 0)
+		}
+
+		select {
+		case <-ctx.Done():
+			quit = true
+		case <-ticker.C:
+			c.events <- AliveCellsCount{turn, currentWorld().Count()}
+		case <-checkpoints:
+			failed = saveCheckpoint(p, c, currentWorld(), turn)
+		case key := <-keyPresses:
+			switch key {
+			case 's':
+				c.events <- StateChange{turn, Executing}
+				failed = outImage(p, currentWorld(), c, turn)
+			case 'c':
+				failed = saveCheckpoint(p, c, currentWorld(), turn)
+			case 'q':
+				c.events <- StateChange{turn, Quitting}
+				quit = true
+			case 'p':
+				c.events <- StateChange{turn, Paused}
+				// The world is edited as a grid, and the torus built again from it
+				edit := func(e util.Edit) {
+					world = currentWorld()
+					for _, cell := range world.Changes(e) {
+						world.Rows[cell.Y].Flip(cell.X)
+						c.events <- CellFlipped{CompletedTurns: turn, Cell: cell}
+					}
+					torus = h.fromGrid(world, level, 0, 0)
+				}
+				if !waitUnpaused(ctx, keyPresses, c.edits, edit) {
+					quit = true
+					break
+				}
+				c.events <- StateChange{turn, Executing}
+				fmt.Println("Continuing")
+			}
+		default:
+		}
+		if failed != nil {
+			quit = true
+		}
+	}
+	if ctx.Err() != nil {
+		c.events <- StateChange{turn, Quitting}
+		return ctx.Err()
+	}
+
+	world = currentWorld()
+	if failed == nil {
+		failed = outImage(p, world, c, turn)
+	}
+	if failed != nil {
+		c.events <- StateChange{turn, Quitting}
+		return failed
+	}
+
+	// Make sure that the Io has finished any output before exiting.
+	c.ioCommand <- ioCheckIdle
+	<-c.ioIdle
+
+	c.events <- FinalTurnComplete{CompletedTurns: turn, Alive: world.AliveCells()}
+	c.events <- StateChange{turn, Quitting}
+	return nil
+}
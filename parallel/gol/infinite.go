@@ -0,0 +1,392 @@
+package gol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Number of cells along each side of a chunk of the infinite plane, so that each row of a chunk is one word
+const chunkSize = 64
+
+// chunkKey is the position of a chunk on the plane, counted in chunks from the one with cell 0, 0 in its top left corner.
+type chunkKey struct {
+	x, y int
+}
+
+// chunk is a square of the plane packed one bit per cell, with the cell at x, y in bit x of word y.
+type chunk [chunkSize]uint64
+
+// plane is the infinite plane, kept as a sparse map of the chunks that have alive cells in them.
+// Every chunk missing from the map is dead, so the plane grows as patterns spread and nothing ever wraps around.
+type plane map[chunkKey]*chunk
+
+// A chunk of dead cells, for the neighbours of chunks at the edge of the alive region
+var deadChunk chunk
+
+// chunkResult is the share of the next turn of the plane worked out by one goroutine.
+type chunkResult struct {
+	chunks map[chunkKey]*chunk
+	alive  int
+}
+
+// Returns the chunk a coordinate is in, and the coordinate within the chunk, rounding down for negative coordinates
+func chunkOf(n int) (int, int) {
+	c := n / chunkSize
+	if n%chunkSize < 0 {
+		c--
+	}
+	return c, n - c*chunkSize
+}
+
+// Puts a world of a fixed size onto the plane, with its top left corner at 0, 0
+func newPlane(world util.BitGrid) plane {
+	p := make(plane)
+	for y, row := range world.Rows {
+		for x := 0; x < world.Width; x++ {
+			if row.Get(x) {
+				p.set(x, y)
+			}
+		}
+	}
+	return p
+}
+
+// Makes the cell at x, y alive
+func (p plane) set(x, y int) {
+	cx, bx := chunkOf(x)
+	cy, by := chunkOf(y)
+	key := chunkKey{cx, cy}
+	if p[key] == nil {
+		p[key] = new(chunk)
+	}
+	p[key][by] |= 1 << uint(bx)
+}
+
+// Flips the cell at x, y
+func (p plane) flip(x, y int) {
+	cx, bx := chunkOf(x)
+	cy, by := chunkOf(y)
+	key := chunkKey{cx, cy}
+	if p[key] == nil {
+		p[key] = new(chunk)
+	}
+	p[key][by] ^= 1 << uint(bx)
+}
+
+// Returns whether the cell at x, y is alive
+func (p plane) get(x, y int) bool {
+	cx, bx := chunkOf(x)
+	cy, by := chunkOf(y)
+	c, ok := p[chunkKey{cx, cy}]
+	return ok && c[by]&(1<<uint(bx)) != 0
+}
+
+// Returns the number of alive cells on the plane
+func (p plane) count() int {
+	count := 0
+	for _, c := range p {
+		for _, word := range c {
+			count += bits.OnesCount64(word)
+		}
+	}
+	return count
+}
+
+// Returns the coordinates of every alive cell, row by row
+func (p plane) aliveCells() []util.Cell {
+	var cells []util.Cell
+	for key, c := range p {
+		for y, word := range c {
+			cells = util.AppendWord(cells, word, key.x*chunkSize, key.y*chunkSize+y)
+		}
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Y != cells[j].Y {
+			return cells[i].Y < cells[j].Y
+		}
+		return cells[i].X < cells[j].X
+	})
+	return cells
+}
+
+// Returns the smallest rectangle holding every alive cell, as its top left corner and size.
+// The size is zero when there are no alive cells.
+func (p plane) bounds() (x, y, width, height int) {
+	first := true
+	var maxX, maxY int
+	for key, c := range p {
+		for row, word := range c {
+			if word == 0 {
+				continue
+			}
+			left := key.x*chunkSize + bits.TrailingZeros64(word)
+			right := key.x*chunkSize + 63 - bits.LeadingZeros64(word)
+			top := key.y*chunkSize + row
+			if first {
+				x, y, maxX, maxY = left, top, right, top
+				first = false
+			}
+			if left < x {
+				x = left
+			}
+			if right > maxX {
+				maxX = right
+			}
+			if top < y {
+				y = top
+			}
+			if top > maxY {
+				maxY = top
+			}
+		}
+	}
+	if first {
+		return 0, 0, 0, 0
+	}
+	return x, y, maxX - x + 1, maxY - y + 1
+}
+
+// Copies the rectangle of the plane with its top left corner at x, y into a world of the given size
+func (p plane) grid(x, y, width, height int) util.BitGrid {
+	world := util.NewBitGrid(width, height)
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			if p.get(x+i, y+j) {
+				world.Rows[j].Set(i, true)
+			}
+		}
+	}
+	return world
+}
+
+// Works out the next state of the chunk at key, from it and the eight chunks around it
+func (p plane) nextChunk(rule util.Rule, key chunkKey) *chunk {
+	var around [3][3]*chunk
+	for j := range around {
+		for i := range around[j] {
+			around[j][i] = &deadChunk
+			if c, ok := p[chunkKey{key.x + i - 1, key.y + j - 1}]; ok {
+				around[j][i] = c
+			}
+		}
+	}
+
+	// Rows of the chunk with the chunks to the left and right, from the row above the chunk to the row below it
+	var words [chunkSize + 2][3]uint64
+	for y := -1; y <= chunkSize; y++ {
+		j, row := 1, y
+		if y < 0 {
+			j, row = 0, chunkSize-1
+		} else if y == chunkSize {
+			j, row = 2, 0
+		}
+		words[y+1] = [3]uint64{around[j][0][row], around[j][1][row], around[j][2][row]}
+	}
+
+	next := new(chunk)
+	for y := range next {
+		// Cells beyond the three chunks are never looked at, as only the middle word is worked out
+		next[y] = rule.NextWord(words[y][:], words[y+1][:], words[y+2][:], 1, 3*chunkSize)
+	}
+	return next
+}
+
+// Works out the next turn of the plane using p.Threads goroutines that each take a share of the chunks,
+// sending a CellFlipped event for every cell that changes, tagged with turn+1 as that is the turn being worked out.
+// Returns the new plane and the number of alive cells on it.
+// Dead chunks next to alive ones are worked out too, so that patterns can grow into them.
+func (p plane) step(params Params, rule util.Rule, turn int, events chan<- Event) (plane, int) {
+	candidates := make(map[chunkKey]bool)
+	for key := range p {
+		for j := -1; j < 2; j++ {
+			for i := -1; i < 2; i++ {
+				candidates[chunkKey{key.x + i, key.y + j}] = true
+			}
+		}
+	}
+	keys := make([]chunkKey, 0, len(candidates))
+	for key := range candidates {
+		keys = append(keys, key)
+	}
+
+	threads := params.Threads
+	if threads < 1 {
+		threads = 1
+	}
+	results := make(chan chunkResult)
+	for t := 0; t < threads; t++ {
+		share := keys[t*len(keys)/threads : (t+1)*len(keys)/threads]
+		go func() {
+			result := chunkResult{chunks: make(map[chunkKey]*chunk)}
+			var flipped []util.Cell
+			for _, key := range share {
+				next := p.nextChunk(rule, key)
+				current, ok := p[key]
+				if !ok {
+					current = &deadChunk
+				}
+				empty := true
+				for y, word := range next {
+					if word != 0 {
+						empty = false
+						result.alive += bits.OnesCount64(word)
+					}
+					flipped = util.AppendWord(flipped[:0], current[y]^word, key.x*chunkSize, key.y*chunkSize+y)
+					for _, cell := range flipped {
+						events <- CellFlipped{CompletedTurns: turn + 1, Cell: cell}
+					}
+				}
+				// Chunks with nothing alive are left out so that the plane only holds the alive region
+				if !empty {
+					result.chunks[key] = next
+				}
+			}
+			results <- result
+		}()
+	}
+
+	next := make(plane)
+	aliveCount := 0
+	for t := 0; t < threads; t++ {
+		result := <-results
+		for key, c := range result.chunks {
+			next[key] = c
+		}
+		aliveCount += result.alive
+	}
+	return next, aliveCount
+}
+
+// Checks that the simulation can run on the infinite plane and returns its rule
+func infiniteRule(p Params, resumed *util.Checkpoint) (util.Rule, error) {
+	rule, err := util.ParseRule(p.Rule)
+	if err != nil {
+		return rule, err
+	}
+	if rule.Birth&1 != 0 {
+		return rule, fmt.Errorf("rule %v has births with no neighbours, which would fill the infinite plane", rule)
+	}
+	if resumed != nil || p.Checkpoint > 0 {
+		return rule, errors.New("checkpoints can't be saved or resumed on the infinite plane")
+	}
+	if p.Engine == "hashlife" {
+		return rule, errors.New("the hashlife engine can't run the infinite plane")
+	}
+	return rule, nil
+}
+
+// Returns the file the alive cells of the plane are written to on a turn.
+// Without an output path it is out/plane-<w>x<h>x<turn>, named after the size of the rectangle holding them,
+// otherwise the turn is added to the end of the name like any other image.
+func planeFilename(p Params, width, height, turn int) string {
+	if p.Output == "" {
+		return "out/plane-" + strconv.Itoa(width) + "x" + strconv.Itoa(height) + "x" + strconv.Itoa(turn) + outputExtension(p)
+	}
+	return outputFilename(p, turn)
+}
+
+// Outputs the smallest rectangle holding every alive cell on the plane as an image in the format the parameters ask for.
+// RLE patterns give the position of its top left corner on the plane. Returns the error from io if it couldn't be written.
+func outPlane(p Params, world plane, c distributorChannels, turn int) error {
+	x, y, width, height := world.bounds()
+	c.ioCommand <- ioOutputPlane
+	outfile := planeFilename(p, width, height, turn)
+	c.ioFilename <- outfile
+	c.ioTurn <- turn
+	c.ioPlane <- planeImage{x: x, y: y, world: world.grid(x, y, width, height)}
+	if err := <-c.ioOutputError; err != nil {
+		return err
+	}
+	c.events <- ImageOutputComplete{turn, outfile}
+	return nil
+}
+
+// infiniteDistributor runs the world on the infinite plane instead of a fixed size world, and interacts with other goroutines.
+// The image is placed with its top left corner at 0, 0, and cells are free to move to any coordinate, including negative ones.
+func infiniteDistributor(ctx context.Context, p Params, c distributorChannels, keyPresses <-chan rune, resumed *util.Checkpoint) error {
+	rule, err := infiniteRule(p, resumed)
+	util.Check(err)
+
+	image, err := readWorld(p, c)
+	if err != nil {
+		return inputFailed(p, c, err)
+	}
+	world := newPlane(image)
+	turn := 0
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	quit := false
+	// Error writing an image, which stops the run
+	var failed error
+	for turn < p.Turns && !quit {
+		var aliveCount int
+		world, aliveCount = world.step(p, rule, turn, c.events)
+		turn++
+		c.events <- TurnComplete{turn}
+
+		select {
+		case <-ctx.Done():
+			quit = true
+		case <-ticker.C:
+			c.events <- AliveCellsCount{turn, aliveCount}
+		case key := <-keyPresses:
+			switch key {
+			case 's':
+				c.events <- StateChange{turn, Executing}
+				failed = outPlane(p, world, c, turn)
+			case 'c':
+				fmt.Println("Checkpoints can't be saved on the infinite plane")
+			case 'q':
+				c.events <- StateChange{turn, Quitting}
+				quit = true
+			case 'p':
+				c.events <- StateChange{turn, Paused}
+				// Every cell is inside the plane
+				edit := func(e util.Edit) {
+					for _, cell := range e.Changes(func(cell util.Cell) (bool, bool) { return world.get(cell.X, cell.Y), true }) {
+						world.flip(cell.X, cell.Y)
+						c.events <- CellFlipped{CompletedTurns: turn, Cell: cell}
+					}
+				}
+				if !waitUnpaused(ctx, keyPresses, c.edits, edit) {
+					quit = true
+					break
+				}
+				c.events <- StateChange{turn, Executing}
+				fmt.Println("Continuing")
+			}
+		default:
+		}
+		if failed != nil {
+			quit = true
+		}
+	}
+	if ctx.Err() != nil {
+		c.events <- StateChange{turn, Quitting}
+		return ctx.Err()
+	}
+
+	if failed == nil {
+		failed = outPlane(p, world, c, turn)
+	}
+	if failed != nil {
+		c.events <- StateChange{turn, Quitting}
+		return failed
+	}
+
+	// Make sure that the Io has finished any output before exiting.
+	c.ioCommand <- ioCheckIdle
+	<-c.ioIdle
+
+	c.events <- FinalTurnComplete{CompletedTurns: turn, Alive: world.aliveCells()}
+	c.events <- StateChange{turn, Quitting}
+	return nil
+}
@@ -2,10 +2,6 @@ package gol
 
 import (
 	"fmt"
-	"io/ioutil"
-	"os"
-	"strconv"
-	"strings"
 	"uk.ac.bris.cs/gameoflife/util"
 )
 
@@ -13,9 +9,20 @@ type ioChannels struct {
 	command <-chan ioCommand
 	idle    chan<- bool
 
-	filename <-chan string
-	output   <-chan uint8
-	input    chan<- uint8
+	filename   <-chan string
+	turn       <-chan int
+	output     <-chan uint8
+	input      chan<- uint8
+	inputError chan<- error
+	// Whether each image was written, sent once it has been
+	outputError chan<- error
+	plane       <-chan planeImage
+}
+
+// planeImage is the part of the infinite plane with alive cells in it, and where its top left corner is on the plane.
+type planeImage struct {
+	x, y  int
+	world util.BitGrid
 }
 
 // ioState is the internal ioState of the io goroutine.
@@ -29,103 +36,108 @@ type ioCommand uint8
 
 // This is a way of creating enums in Go.
 // It will evaluate to:
-//		ioOutput 	= 0
-//		ioInput 	= 1
-//		ioCheckIdle = 2
+//
+//	ioOutput 	= 0
+//	ioInput 	= 1
+//	ioCheckIdle = 2
+//	ioOutputPlane = 3
 const (
 	ioOutput ioCommand = iota
 	ioInput
 	ioCheckIdle
+	ioOutputPlane
 )
 
-// writePgmImage receives an array of bytes and writes it to a pgm file.
-func (io *ioState) writePgmImage() {
-	_ = os.Mkdir("out", os.ModePerm)
-
-	// Request a filename from the distributor.
+// writeImage receives an array of bytes and writes it to an image in the format the parameters ask for.
+func (io *ioState) writeImage() {
+	// Request a filename and the turn of the image from the distributor.
 	filename := <-io.channels.filename
+	turn := <-io.channels.turn
 
-	file, ioError := os.Create("out/" + filename + ".pgm")
-	util.Check(ioError)
-	defer file.Close()
-
-	_, _ = file.WriteString("P5\n")
-	//_, _ = file.WriteString("# PGM file writer by pnmmodules (https://github.com/owainkenwayucl/pnmmodules).\n")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageWidth))
-	_, _ = file.WriteString(" ")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageHeight))
-	_, _ = file.WriteString("\n")
-	_, _ = file.WriteString(strconv.Itoa(255))
-	_, _ = file.WriteString("\n")
-
-	world := make([][]byte, io.params.ImageHeight)
-	for i := range world {
-		world[i] = make([]byte, io.params.ImageWidth)
-	}
-
+	world := util.NewBitGrid(io.params.ImageWidth, io.params.ImageHeight)
 	for y := 0; y < io.params.ImageHeight; y++ {
 		for x := 0; x < io.params.ImageWidth; x++ {
-			val := <-io.channels.output
-			//if val != 0 {
-			//	fmt.Println(x, y)
-			//}
-			world[y][x] = val
+			world.Rows[y].Set(x, <-io.channels.output == 255)
 		}
 	}
 
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
-			_, ioError = file.Write([]byte{world[y][x]})
-			util.Check(ioError)
-		}
+	ioError := writeImageFile(filename, world, io.params, turn)
+	io.channels.outputError <- ioError
+	if ioError != nil {
+		return
 	}
 
-	ioError = file.Sync()
-	util.Check(ioError)
-
 	fmt.Println("File", filename, "output done!")
 }
 
-// readPgmImage opens a pgm file and sends its data as an array of bytes.
-func (io *ioState) readPgmImage() {
-
-	// Request a filename from the distributor.
+// writePlaneImage receives part of the infinite plane and writes it like any other image.
+// RLE patterns give the position of its top left corner with #R, so the pattern can be put back where it was.
+func (io *ioState) writePlaneImage() {
+	// Request a filename, the turn and the image from the distributor.
 	filename := <-io.channels.filename
+	turn := <-io.channels.turn
+	image := <-io.channels.plane
+
+	ioError := writeImageFile(filename, image.world, io.params, turn, fmt.Sprintf("#R %d %d", image.x, image.y))
+	io.channels.outputError <- ioError
+	if ioError != nil {
+		return
+	}
 
-	data, ioError := ioutil.ReadFile("images/" + filename + ".pgm")
-	util.Check(ioError)
+	fmt.Println("File", filename, "output done!")
+}
 
-	fields := strings.Fields(string(data))
+// readImage reads the pbm or pgm image or the pattern the distributor asks for and sends its data as an array of bytes.
+// Whether it could be read is sent first, and nothing else is sent if it couldn't.
+func (io *ioState) readImage() {
 
-	if fields[0] != "P5" {
-		panic("Not a pgm file")
-	}
+	// Request a filename from the distributor.
+	filename := <-io.channels.filename
 
-	width, _ := strconv.Atoi(fields[1])
-	if width != io.params.ImageWidth {
-		panic("Incorrect width")
+	var world util.BitGrid
+	var ioError error
+	if util.IsPatternFile(filename) {
+		world, ioError = io.readPattern(filename)
+	} else {
+		world, ioError = io.readPgmImage(filename)
 	}
-
-	height, _ := strconv.Atoi(fields[2])
-	if height != io.params.ImageHeight {
-		panic("Incorrect height")
+	io.channels.inputError <- ioError
+	if ioError != nil {
+		return
 	}
 
-	maxval, _ := strconv.Atoi(fields[3])
-	if maxval != 255 {
-		panic("Incorrect maxval/bit depth")
+	for _, row := range world.Unpack() {
+		for _, b := range row {
+			io.channels.input <- b
+		}
 	}
 
-	image := []byte(fields[4])
+	fmt.Println("File", filename, "input done!")
+}
 
-	for _, b := range image {
-		io.channels.input <- b
+// readPattern opens an RLE or plaintext pattern and places it at the offset in a world the size of the image.
+func (io *ioState) readPattern(filename string) (util.BitGrid, error) {
+	pattern, ioError := util.ReadPattern(filename)
+	if ioError != nil {
+		return util.BitGrid{}, ioError
 	}
+	return pattern.Place(io.params.ImageWidth, io.params.ImageHeight, io.params.Offset)
+}
 
-	fmt.Println("File", filename, "input done!")
+// readPgmImage opens a pbm or pgm file, which has to be the size of the world.
+func (io *ioState) readPgmImage(filename string) (util.BitGrid, error) {
+	world, ioError := util.ReadImage(filename)
+	if ioError != nil {
+		return world, ioError
+	}
+	if world.Width != io.params.ImageWidth || world.Height != io.params.ImageHeight {
+		return world, fmt.Errorf("%s: the image is %dx%d, but the world is %dx%d",
+			filename, world.Width, world.Height, io.params.ImageWidth, io.params.ImageHeight)
+	}
+	return world, nil
 }
 
-// startIo should be the entrypoint of the io goroutine.
+// startIo should be the entrypoint of the io goroutine, which returns once the command channel is closed.
 func startIo(p Params, c ioChannels) {
 	io := ioState{
 		params:   p,
@@ -134,15 +146,20 @@ func startIo(p Params, c ioChannels) {
 
 	for {
 		select {
-		// Block and wait for requests from the distributor
-		case command := <-io.channels.command:
+		// Block and wait for requests from the distributor, until the simulation closes the commands when it has finished
+		case command, ok := <-io.channels.command:
+			if !ok {
+				return
+			}
 			switch command {
 			case ioInput:
-				io.readPgmImage()
+				io.readImage()
 			case ioOutput:
-				io.writePgmImage()
+				io.writeImage()
 			case ioCheckIdle:
 				io.channels.idle <- true
+			case ioOutputPlane:
+				io.writePlaneImage()
 			}
 		}
 	}
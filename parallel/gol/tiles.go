@@ -0,0 +1,97 @@
+package gol
+
+// Number of rows in a band of tiles, where each tile is one word of 64 cells wide
+const tileHeight = 16
+
+// tileBand is a band of rows split into tiles, which never crosses from one worker's strip into another's.
+type tileBand struct {
+	startY int
+	endY   int
+}
+
+// tileMap splits the world into tiles and keeps track of which of them changed on the last turn.
+// A tile only needs calculating when a cell in it or in one of the tiles next to it flipped on the turn before,
+// so stable and empty parts of the world are skipped.
+type tileMap struct {
+	// Number of tiles across the world, one for each word of a row
+	columns int
+	bands   []tileBand
+	// Band that each row of the world is in
+	rowBand []int
+	// Tiles that hold the neighbours of the cells in each tile, according to the topology, including the tile itself
+	neighbours [][]int
+	// Which tiles had a cell flip on even and odd turns, each tile only written by the worker that owns it
+	changed [2][]bool
+}
+
+// Splits the strips of the workers into tiles, giving each worker the range of bands it owns.
+// Every tile counts as changed on the turn the workers start from, so that they are all calculated first time.
+func newTileMap(p Params, workers []*worker, turn int) *tileMap {
+	t := &tileMap{
+		columns: (p.ImageWidth + 63) / 64,
+		rowBand: make([]int, p.ImageHeight),
+	}
+	for _, w := range workers {
+		w.firstBand = len(t.bands)
+		for y := w.startY; y < w.endY; y += tileHeight {
+			band := tileBand{startY: y, endY: y + tileHeight}
+			if band.endY > w.endY {
+				band.endY = w.endY
+			}
+			for r := band.startY; r < band.endY; r++ {
+				t.rowBand[r] = len(t.bands)
+			}
+			t.bands = append(t.bands, band)
+		}
+		w.lastBand = len(t.bands)
+		w.alive = make([]int, (w.lastBand-w.firstBand)*t.columns)
+	}
+
+	tiles := len(t.bands) * t.columns
+	t.neighbours = make([][]int, tiles)
+	for tile := range t.neighbours {
+		band, column := t.bands[tile/t.columns], tile%t.columns
+		startX, endX := column*64, (column+1)*64
+		if endX > p.ImageWidth {
+			endX = p.ImageWidth
+		}
+		found := map[int]bool{tile: true}
+		addTile := func(x, y int) {
+			c, r, inside := p.Topology.Resolve(x, y, p.ImageWidth, p.ImageHeight)
+			if inside {
+				found[t.rowBand[r]*t.columns+c/64] = true
+			}
+		}
+		// Only the ring of cells around the tile can be in other tiles
+		for x := startX - 1; x <= endX; x++ {
+			addTile(x, band.startY-1)
+			addTile(x, band.endY)
+		}
+		for y := band.startY; y < band.endY; y++ {
+			addTile(startX-1, y)
+			addTile(endX, y)
+		}
+		for neighbour := range found {
+			t.neighbours[tile] = append(t.neighbours[tile], neighbour)
+		}
+	}
+
+	t.changed[0] = make([]bool, tiles)
+	t.changed[1] = make([]bool, tiles)
+	for tile := range t.changed[turn%2] {
+		t.changed[turn%2][tile] = true
+	}
+	return t
+}
+
+// Returns whether the tile needs calculating on the turn after the given one,
+// because a cell in it or next to it flipped on that turn
+func (t *tileMap) active(tile, turn int) bool {
+	changed := t.changed[turn%2]
+	for _, neighbour := range t.neighbours[tile] {
+		if changed[neighbour] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,375 @@
+package gol
+
+import (
+	"math/bits"
+	"sort"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// haloRow is a row of the world sent by the worker that owns it to a worker that needs it as a halo.
+type haloRow struct {
+	y     int
+	cells util.BitRow
+}
+
+// haloSend is a row that a worker sends to another worker at the start of every turn.
+type haloSend struct {
+	y  int
+	to chan<- haloRow
+}
+
+// workerCommand allows the distributor to request behaviour from a worker goroutine.
+type workerCommand uint8
+
+const (
+	workerStep workerCommand = iota
+	workerSnapshot
+	workerStop
+)
+
+// workerResult is sent back to the distributor once a worker has carried out a command.
+type workerResult struct {
+	// Number of alive cells in the strip after a step
+	alive int
+	// Copy of the strip, only filled in for a snapshot
+	strip []util.BitRow
+}
+
+// worker is a long-lived goroutine that owns the rows startY to endY of the world.
+// Every turn it exchanges halo rows directly with the workers that own the neighbouring rows.
+type worker struct {
+	p      Params
+	rule   util.Rule
+	startY int
+	endY   int
+	turn   int
+
+	// The strip of the world owned by this worker, packed one bit per cell, and the buffer the next turn is written to
+	strip []util.BitRow
+	next  []util.BitRow
+	// Rows of the world owned by other workers, received at the start of each turn
+	halos map[int]util.BitRow
+	// Rows beyond the top and bottom edges of the world, only used by the first and last workers
+	outer [2]util.BitRow
+	// Cells that flipped in the row being calculated, kept to save allocating every row
+	flipped []util.Cell
+
+	// Tiles of the world, shared between every worker, and the bands of tiles this worker owns
+	tiles     *tileMap
+	firstBand int
+	lastBand  int
+	// Number of alive cells in each tile this worker owns, as of the last time it was calculated
+	alive []int
+	// Which tiles in the band being calculated are active
+	active []bool
+
+	inbox  chan haloRow
+	sends  []haloSend
+	needed int
+
+	commands chan workerCommand
+	results  chan workerResult
+	events   chan<- Event
+}
+
+// Splits the world into strips and starts a worker goroutine for each one, wiring up the halo exchanges between them.
+func startWorkers(p Params, rule util.Rule, world util.BitGrid, turn int, events chan<- Event) []*worker {
+	// Every worker needs at least one row
+	threads := p.Threads
+	if threads > p.ImageHeight {
+		threads = p.ImageHeight
+	}
+	if threads < 1 {
+		threads = 1
+	}
+
+	workers := make([]*worker, threads)
+	for i := range workers {
+		startY := i * p.ImageHeight / threads
+		endY := (i + 1) * p.ImageHeight / threads
+		w := &worker{
+			p:        p,
+			rule:     rule,
+			startY:   startY,
+			endY:     endY,
+			turn:     turn,
+			strip:    util.NewBitGrid(p.ImageWidth, endY-startY).Rows,
+			next:     util.NewBitGrid(p.ImageWidth, endY-startY).Rows,
+			halos:    make(map[int]util.BitRow),
+			commands: make(chan workerCommand),
+			results:  make(chan workerResult),
+			events:   events,
+		}
+		for y := startY; y < endY; y++ {
+			copy(w.strip[y-startY], world.Rows[y])
+		}
+		w.outer[0] = util.NewBitRow(p.ImageWidth)
+		w.outer[1] = util.NewBitRow(p.ImageWidth)
+		workers[i] = w
+	}
+
+	tiles := newTileMap(p, workers, turn)
+	for _, w := range workers {
+		w.tiles = tiles
+		w.active = make([]bool, tiles.columns)
+	}
+
+	// Tell the owner of every halo row where to send it
+	for _, w := range workers {
+		rows := haloRowsNeeded(p, w.startY, w.endY)
+		// Buffered so that sending a halo never waits for the receiving worker
+		w.inbox = make(chan haloRow, len(rows))
+		w.needed = len(rows)
+		for _, y := range rows {
+			for _, owner := range workers {
+				if y >= owner.startY && y < owner.endY {
+					owner.sends = append(owner.sends, haloSend{y: y, to: w.inbox})
+				}
+			}
+		}
+	}
+
+	for _, w := range workers {
+		go w.run()
+	}
+	return workers
+}
+
+// Finds the rows outside of a strip that the cells in the strip have as neighbours, according to the topology.
+func haloRowsNeeded(p Params, startY, endY int) []int {
+	needed := make(map[int]bool)
+	addNeighbours := func(x, y int) {
+		for i := -1; i < 2; i++ {
+			for j := -1; j < 2; j++ {
+				_, r, inside := p.Topology.Resolve(x+i, y+j, p.ImageWidth, p.ImageHeight)
+				if inside && (r < startY || r >= endY) {
+					needed[r] = true
+				}
+			}
+		}
+	}
+	// Only cells on the border of the strip can have neighbours outside of it
+	for x := 0; x < p.ImageWidth; x++ {
+		addNeighbours(x, startY)
+		addNeighbours(x, endY-1)
+	}
+	for y := startY; y < endY; y++ {
+		addNeighbours(0, y)
+		addNeighbours(p.ImageWidth-1, y)
+	}
+
+	var rows []int
+	for y := range needed {
+		rows = append(rows, y)
+	}
+	sort.Ints(rows)
+	return rows
+}
+
+// Sends a command to every worker and waits for all of them to finish, which acts as the barrier between turns.
+func commandWorkers(workers []*worker, command workerCommand) []workerResult {
+	for _, w := range workers {
+		w.commands <- command
+	}
+	results := make([]workerResult, len(workers))
+	for i, w := range workers {
+		results[i] = <-w.results
+	}
+	return results
+}
+
+// Runs one turn on every worker and returns the number of alive cells in the new world
+func stepWorkers(workers []*worker) int {
+	aliveCount := 0
+	for _, result := range commandWorkers(workers, workerStep) {
+		aliveCount += result.alive
+	}
+	return aliveCount
+}
+
+// Collects the strips from every worker into a new copy of the world
+func collectWorld(p Params, workers []*worker) util.BitGrid {
+	world := util.BitGrid{Width: p.ImageWidth, Height: p.ImageHeight}
+	for _, result := range commandWorkers(workers, workerSnapshot) {
+		world.Rows = append(world.Rows, result.strip...)
+	}
+	return world
+}
+
+// Makes an edit to the strips of the workers, which are waiting for their next command while the world is paused.
+// The tiles with cells that flip are marked as changed, so that the workers calculate them on the next turn.
+func editWorkers(p Params, workers []*worker, edit util.Edit, turn int, events chan<- Event) {
+	world := util.BitGrid{Width: p.ImageWidth, Height: p.ImageHeight}
+	for _, w := range workers {
+		world.Rows = append(world.Rows, w.strip...)
+	}
+	tiles := workers[0].tiles
+	for _, cell := range world.Changes(edit) {
+		world.Rows[cell.Y].Flip(cell.X)
+		tiles.changed[turn%2][tiles.rowBand[cell.Y]*tiles.columns+cell.X/64] = true
+		events <- CellFlipped{CompletedTurns: turn, Cell: cell}
+	}
+}
+
+// Stops every worker goroutine
+func stopWorkers(workers []*worker) {
+	for _, w := range workers {
+		w.commands <- workerStop
+	}
+}
+
+// Entrypoint of a worker goroutine, which carries out commands from the distributor until it is stopped
+func (w *worker) run() {
+	for command := range w.commands {
+		switch command {
+		case workerStep:
+			w.exchangeHalos()
+			alive := w.calculateNextState()
+			w.strip, w.next = w.next, w.strip
+			w.turn++
+			w.results <- workerResult{alive: alive}
+		case workerSnapshot:
+			strip := util.BitGrid{Rows: w.strip}.Copy().Rows
+			w.results <- workerResult{strip: strip}
+		case workerStop:
+			return
+		}
+	}
+}
+
+// Sends the rows of the strip that other workers need, then waits for the halo rows this worker needs.
+// The rows are sent without copying, as the owner only overwrites them after every worker has finished the turn.
+func (w *worker) exchangeHalos() {
+	for _, send := range w.sends {
+		send.to <- haloRow{y: send.y, cells: w.strip[send.y-w.startY]}
+	}
+	for i := 0; i < w.needed; i++ {
+		halo := <-w.inbox
+		w.halos[halo.y] = halo.cells
+	}
+}
+
+// Returns row y of the world, either from the strip or from the halos
+func (w *worker) row(y int) util.BitRow {
+	if y >= w.startY && y < w.endY {
+		return w.strip[y-w.startY]
+	}
+	return w.halos[y]
+}
+
+// Works out the row of neighbours above or below the edge of the world, as the topology sees it from inside
+func (w *worker) updateOuterRow(y int) {
+	row := w.outer[0]
+	if y >= w.p.ImageHeight {
+		row = w.outer[1]
+	}
+	for x := 0; x < w.p.ImageWidth; x++ {
+		c, r, inside := w.p.Topology.Resolve(x, y, w.p.ImageWidth, w.p.ImageHeight)
+		row.Set(x, inside && w.row(r).Get(c))
+	}
+}
+
+// Returns the row of neighbours at y, which may be just outside of the world
+func (w *worker) neighbourRow(y int) util.BitRow {
+	if y < 0 {
+		return w.outer[0]
+	}
+	if y >= w.p.ImageHeight {
+		return w.outer[1]
+	}
+	return w.row(y)
+}
+
+// GoL logic to calculate the next state of the strip into w.next, returns the number of alive cells
+// Only the tiles with a flipped cell in or next to them on the last turn are calculated, the rest are copied over
+func (w *worker) calculateNextState() int {
+	width := w.p.ImageWidth
+	columns := w.tiles.columns
+	changed := w.tiles.changed[(w.turn+1)%2]
+	if w.startY == 0 {
+		w.updateOuterRow(-1)
+	}
+	if w.endY == w.p.ImageHeight {
+		w.updateOuterRow(w.p.ImageHeight)
+	}
+
+	aliveCount := 0
+	for band := w.firstBand; band < w.lastBand; band++ {
+		firstTile := band * columns
+		alive := w.alive[(band-w.firstBand)*columns:][:columns]
+		anyActive := false
+		for i := range w.active {
+			w.active[i] = w.tiles.active(firstTile+i, w.turn)
+			changed[firstTile+i] = false
+			if w.active[i] {
+				alive[i] = 0
+				anyActive = true
+			}
+		}
+
+		for y := w.tiles.bands[band].startY; y < w.tiles.bands[band].endY; y++ {
+			current, newRow := w.row(y), w.next[y-w.startY]
+			if !anyActive {
+				copy(newRow, current)
+				continue
+			}
+			above, below := w.neighbourRow(y-1), w.neighbourRow(y+1)
+			for i, active := range w.active {
+				if active {
+					// Birth and survival decided by the rule, B3/S23 unless another rule is given, 64 cells at a time
+					newRow[i] = w.rule.NextWord(above, current, below, i, width)
+				} else {
+					newRow[i] = current[i]
+				}
+			}
+
+			// The neighbours of cells on the left and right edges depend on the topology
+			for _, x := range [2]int{0, width - 1} {
+				if w.active[x/64] {
+					newRow.Set(x, w.rule.Next(current.Get(x), w.countNeighbours(x, y)))
+				}
+			}
+
+			// Notify the GUI of cells that were born or died
+			for i, active := range w.active {
+				if !active {
+					continue
+				}
+				alive[i] += bits.OnesCount64(newRow[i])
+				if flips := current[i] ^ newRow[i]; flips != 0 {
+					changed[firstTile+i] = true
+					w.flipped = util.AppendWord(w.flipped[:0], flips, i*64, y)
+					for _, cell := range w.flipped {
+						// The cell flips on the turn being worked out, one after the turn the worker is on
+						w.events <- CellFlipped{CompletedTurns: w.turn + 1, Cell: cell}
+					}
+				}
+			}
+		}
+
+		for _, count := range alive {
+			aliveCount += count
+		}
+	}
+	return aliveCount
+}
+
+// Counts the number of neighbours for each cell/entry
+func (w *worker) countNeighbours(x, y int) int {
+	var aliveCount = 0
+	for i := -1; i < 2; i++ {
+		for j := -1; j < 2; j++ {
+			// Don't count self as neighbour
+			if i == 0 && j == 0 {
+				continue
+			}
+			// Find the neighbour according to the topology, wrapping around on a torus
+			r, c, inside := w.p.Topology.Resolve(x+i, y+j, w.p.ImageWidth, w.p.ImageHeight)
+			if inside && w.row(c).Get(r) {
+				aliveCount++
+			}
+		}
+	}
+	return aliveCount
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestHashLife tests the hashlife engine on the images in check/images for 0, 1 and 100 turns, one turn at a time and jumping,
+// then jumps a 512x512 world on by 10000 and a billion turns and checks the number of alive cells.
+func TestHashLife(t *testing.T) {
+	for _, size := range []int{16, 64, 512} {
+		for _, turns := range []int{0, 1, 100} {
+			for _, jump := range []bool{false, true} {
+				p := gol.Params{Turns: turns, ImageWidth: size, ImageHeight: size, Engine: "hashlife", Jump: jump}
+				expectedAlive := readAliveCells(
+					"check/images/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns),
+					p.ImageWidth,
+					p.ImageHeight,
+				)
+				t.Run(fmt.Sprintf("%dx%dx%d-jump=%v", size, size, turns, jump), func(t *testing.T) {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					var cells []util.Cell
+					completed := 0
+					for event := range events {
+						switch e := event.(type) {
+						case gol.TurnComplete:
+							completed++
+						case gol.FinalTurnComplete:
+							cells = e.Alive
+						}
+					}
+					if expected := map[bool]int{false: turns, true: 0}[jump]; completed != expected {
+						t.Errorf("expected %v TurnComplete events, got %v", expected, completed)
+					}
+					assertEqualBoard(t, cells, expectedAlive, p)
+				})
+			}
+		}
+	}
+
+	// The 512x512 world settles into a blinking pattern with 5565 and 5567 alive cells
+	for turns, expected := range map[int]int{10000: 5565, 1000000000: 5565, 1000000001: 5567} {
+		p := gol.Params{Turns: turns, ImageWidth: 512, ImageHeight: 512, Engine: "hashlife", Jump: true}
+		t.Run(fmt.Sprintf("512x512x%d", turns), func(t *testing.T) {
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			for event := range events {
+				if final, ok := event.(gol.FinalTurnComplete); ok {
+					if final.CompletedTurns != turns || len(final.Alive) != expected {
+						t.Errorf("expected %v alive cells after %v turns, got %v after %v", expected, turns, len(final.Alive), final.CompletedTurns)
+					}
+				}
+			}
+		})
+	}
+}
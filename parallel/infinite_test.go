@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestInfinite runs worlds on the infinite plane.
+// The glider in the 16x16 image should fly off the image without wrapping around, and come out as the RLE pattern -output asks for.
+// Its cells should flip on the turn being worked out, like on a fixed size world.
+// The 64x64 image should match running it in the middle of a torus large enough that nothing reaches the edges.
+func TestInfinite(t *testing.T) {
+	t.Run("glider", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "infinite")
+		util.Check(err)
+		defer os.RemoveAll(dir)
+		p := gol.Params{Turns: 1000, Threads: 4, ImageWidth: 16, ImageHeight: 16, Infinite: true, Output: filepath.Join(dir, "glider.rle")}
+		events := make(chan gol.Event)
+		go gol.Run(p, events, nil)
+		var cells []util.Cell
+		var output gol.ImageOutputComplete
+		completed := 0
+		for event := range events {
+			switch e := event.(type) {
+			case gol.CellFlipped:
+				// The cells of the image flip before the first turn
+				if e.CompletedTurns != completed+1 && (completed != 0 || e.CompletedTurns != 0) {
+					t.Fatalf("expected the cells flipped after turn %v to flip on turn %v, got %v", completed, completed+1, e.CompletedTurns)
+				}
+			case gol.TurnComplete:
+				completed = e.CompletedTurns
+			case gol.ImageOutputComplete:
+				output = e
+			case gol.FinalTurnComplete:
+				cells = e.Alive
+			}
+		}
+
+		var expected []util.Cell
+		for _, cell := range []util.Cell{{X: 4, Y: 5}, {X: 5, Y: 6}, {X: 3, Y: 7}, {X: 4, Y: 7}, {X: 5, Y: 7}} {
+			expected = append(expected, util.Cell{X: cell.X + p.Turns/4, Y: cell.Y + p.Turns/4})
+		}
+		assertEqualBoard(t, cells, expected, gol.Params{ImageWidth: 512, ImageHeight: 512})
+
+		if expected := filepath.Join(dir, "glider-1000.rle"); output.Filename != expected {
+			t.Fatalf("expected the bounding box to be output as %v, got %q", expected, output.Filename)
+		}
+		rle, err := ioutil.ReadFile(output.Filename)
+		util.Check(err)
+		if expected := "#N glider-1000\n#C Generation 1000\n#R 253 255\nx = 3, y = 3, rule = B3/S23\nbo$2bo$3o!\n"; string(rle) != expected {
+			t.Errorf("expected RLE pattern\n%v\ngot\n%v", expected, string(rle))
+		}
+	})
+
+	for _, threads := range []int{1, 4} {
+		p := gol.Params{Turns: 100, Threads: threads, ImageWidth: 64, ImageHeight: 64, Infinite: true}
+		t.Run(fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			var cells []util.Cell
+			for event := range events {
+				if final, ok := event.(gol.FinalTurnComplete); ok {
+					cells = final.Alive
+				}
+			}
+
+			// Patterns spread by at most one cell a turn, so a margin of more than p.Turns around the image is never reached
+			margin := p.Turns + 28
+			torus := gol.Params{Turns: p.Turns, Threads: threads, ImageWidth: p.ImageWidth + 2*margin, ImageHeight: p.ImageHeight + 2*margin}
+			world := util.NewBitGrid(torus.ImageWidth, torus.ImageHeight)
+			for _, cell := range readAliveCells("images/64x64.pgm", p.ImageWidth, p.ImageHeight) {
+				world.Rows[cell.Y+margin].Set(cell.X+margin, true)
+			}
+			filename := writeWorld(torus, world)
+			defer os.Remove(filename)
+			var expected []util.Cell
+			for _, cell := range runWorld(filename, threads) {
+				expected = append(expected, util.Cell{X: cell.X - margin, Y: cell.Y - margin})
+			}
+			assertEqualBoard(t, cells, expected, torus)
+		})
+	}
+}
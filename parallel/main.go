@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"os"
 	"runtime"
+	"time"
 
 	"uk.ac.bris.cs/gameoflife/gol"
 	"uk.ac.bris.cs/gameoflife/sdl"
+	"uk.ac.bris.cs/gameoflife/tui"
+	"uk.ac.bris.cs/gameoflife/util"
+	"uk.ac.bris.cs/gameoflife/web"
 )
 
 // main is the function called when starting Game of Life with 'go run .'
@@ -38,31 +44,237 @@ func main() {
 		10000000000,
 		"Specify the number of turns to process. Defaults to 10000000000.")
 
+	flag.StringVar(
+		&params.Rule,
+		"rule",
+		"B3/S23",
+		"Specify the Life-like rule in B/S notation (e.g. B36/S23) or by name (e.g. highlife). Defaults to B3/S23.")
+
+	flag.Var(
+		&params.Topology,
+		"topology",
+		"Specify what lies beyond the edges of the world: torus, bounded, reflect, klein or projective. Defaults to torus.")
+
+	flag.StringVar(
+		&params.Input,
+		"input",
+		"",
+		"Specify the pgm image, RLE pattern (.rle) or plaintext pattern (.cells) to read the world from. Patterns go in a world the size of -w and -h, and use the rule in an RLE header unless -rule is given. Defaults to images/<w>x<h>.pgm.")
+
+	offset := flag.String(
+		"offset",
+		"0,0",
+		"Specify where the top left corner of an RLE or plaintext pattern goes in the world, as x,y. Defaults to 0,0.")
+
+	flag.StringVar(
+		&params.Output,
+		"output",
+		"",
+		"Specify where images are written, with the turn added to the end of the name, e.g. runs/glider.png becomes runs/glider-100.png. Its extension picks the format unless -format is given. Defaults to out/<w>x<h>x<turn>.pgm.")
+
+	flag.StringVar(
+		&params.Format,
+		"format",
+		"",
+		"Specify the format images are written in: pgm, p2 (plain pgm), pbm (plain), rle or png, optionally followed by .gz to compress them. Defaults to the extension of -output, or pgm.")
+
+	flag.IntVar(
+		&params.CellSize,
+		"cellSize",
+		1,
+		"Specify the number of pixels along each side of a cell in png images. Defaults to 1.")
+
+	flag.StringVar(
+		&params.AliveColour,
+		"alive",
+		"ffffff",
+		"Specify the colour of alive cells in png images as rrggbb. Defaults to ffffff.")
+
+	flag.StringVar(
+		&params.DeadColour,
+		"dead",
+		"000000",
+		"Specify the colour of dead cells in png images as rrggbb. Defaults to 000000.")
+
+	flag.StringVar(
+		&params.Record,
+		"record",
+		"",
+		"Specify a .gif file to record the run into as an animation, or a .png file to record it into numbered frames, e.g. runs/glider.png becomes runs/glider-000100.png. Uses -cellSize, -alive and -dead. Defaults to no recording.")
+
+	flag.IntVar(
+		&params.RecordFrom,
+		"recordFrom",
+		0,
+		"Specify the first turn to record. Defaults to 0.")
+
+	flag.IntVar(
+		&params.RecordTo,
+		"recordTo",
+		0,
+		"Specify the last turn to record. Defaults to 0, recording up to the last turn.")
+
+	flag.IntVar(
+		&params.RecordEvery,
+		"recordEvery",
+		1,
+		"Specify the number of turns between recorded frames. Defaults to 1.")
+
+	flag.DurationVar(
+		&params.RecordDelay,
+		"recordDelay",
+		100*time.Millisecond,
+		"Specify how long each frame of a recorded gif is shown for. Defaults to 100ms.")
+
+	flag.StringVar(
+		&params.Resume,
+		"resume",
+		"",
+		"Specify a checkpoint to carry on from. Its world, size, rule and topology replace the image and the flags.")
+
+	flag.DurationVar(
+		&params.Checkpoint,
+		"checkpoint",
+		0,
+		"Specify how often to save a checkpoint next to the images, e.g. 1m. Defaults to 0, only saving one when c is pressed.")
+
+	flag.StringVar(
+		&params.Engine,
+		"engine",
+		"parallel",
+		"Specify the engine that runs the world: parallel or hashlife. Hashlife needs a torus with sides that are powers of two. Defaults to parallel.")
+
+	flag.BoolVar(
+		&params.Infinite,
+		"infinite",
+		false,
+		"Run the world on an infinite plane that grows as patterns spread, starting from the image. The window follows the alive cells until f is pressed.")
+
 	noVis := flag.Bool(
 		"noVis",
 		false,
 		"Disables the SDL window, so there is no visualisation during the tests.")
 
+	scale := flag.Float64(
+		"scale",
+		0,
+		"Specify the number of pixels along each side of a cell in the SDL window, which the mouse wheel zooms. Defaults to 0, fitting the world on the screen.")
+
+	showTui := flag.Bool(
+		"tui",
+		false,
+		"Show the world in the terminal instead of an SDL window, so that it can be watched and driven over SSH.")
+
+	httpAddress := flag.String(
+		"http",
+		"",
+		"Serve a viewer to browsers on an address instead of opening an SDL window. localhost:8080 only serves this machine, and :8080 serves every network interface, where anyone who can reach it can pause, quit or kill the run.")
+
 	flag.Parse()
 
+	if _, err := fmt.Sscanf(*offset, "%d,%d", &params.Offset.X, &params.Offset.Y); err != nil {
+		fmt.Printf("invalid offset %q: expected the form x,y\n", *offset)
+		os.Exit(2)
+	}
+	// A pattern's own rule is used unless -rule is given
+	ruleGiven := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "rule" {
+			ruleGiven = true
+		}
+	})
+	if !ruleGiven && util.IsPatternFile(params.Input) {
+		pattern, err := util.ReadPattern(params.Input)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		params.Rule = pattern.Rule
+	}
+
+	// The window has to be the size of the world saved in the checkpoint
+	if params.Resume != "" {
+		checkpoint, err := util.ReadCheckpoint(params.Resume)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		params.ImageWidth, params.ImageHeight = checkpoint.ImageWidth, checkpoint.ImageHeight
+		params.Rule, params.Topology = checkpoint.Rule, checkpoint.Topology
+	}
+
+	rule, err := util.ParseRule(params.Rule)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	// Without a window to show every turn, hashlife can skip ahead by powers of two turns
+	params.Jump = *noVis && !*showTui && *httpAddress == "" && params.Record == ""
+
 	fmt.Println("Threads:", params.Threads)
 	fmt.Println("Width:", params.ImageWidth)
 	fmt.Println("Height:", params.ImageHeight)
+	fmt.Println("Rule:", rule)
+	if params.Infinite {
+		fmt.Println("Topology: infinite plane")
+	} else {
+		fmt.Println("Topology:", params.Topology)
+	}
+	fmt.Println("Engine:", params.Engine)
 
 	keyPresses := make(chan rune, 10)
+	// Cells clicked in the window while the world is paused
+	edits := make(chan util.Edit, 10)
 	events := make(chan gol.Event, 1000)
 
-	go gol.Run(params, events, keyPresses)
-	if !(*noVis) {
-		sdl.Run(params, events, keyPresses)
+	// The recorder passes the events on to the window once it has taken its frames from them
+	recorded, err := gol.Record(params, events)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	// The address is checked before the run starts, so that it doesn't run without anyone able to see it
+	var server *web.Server
+	if *httpAddress != "" {
+		server, err = web.Listen(*httpAddress)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		fmt.Printf("Viewer: http://%v/\n", server.Addr())
+	}
+	// Invalid parameters are reported before anything runs
+	simulation, err := gol.Start(context.Background(), params, gol.WithEvents(events), gol.WithKeyPresses(keyPresses), gol.WithEdits(edits))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if server != nil {
+		server.Run(params, recorded, keyPresses)
+	} else if *showTui {
+		tui.Run(params, recorded, keyPresses)
+	} else if !(*noVis) {
+		sdl.Run(params, *scale, recorded, keyPresses, edits)
 	} else {
 		complete := false
 		for !complete {
-			event := <-events
-			switch event.(type) {
+			event, ok := <-recorded
+			// The events are closed without a FinalTurnComplete when the world can't be read
+			if !ok {
+				break
+			}
+			switch e := event.(type) {
+			case gol.ImageInputError:
+				fmt.Println(e)
+				os.Exit(1)
 			case gol.FinalTurnComplete:
 				complete = true
 			}
 		}
 	}
+	// A run that failed part way, such as when an image couldn't be written, ends without a FinalTurnComplete
+	if err := simulation.Wait(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
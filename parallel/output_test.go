@@ -0,0 +1,136 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Reads the alive cells back out of an RLE, PNG, plain PBM or plain PGM image, which may be gzipped
+func readOutputCells(t *testing.T, filename string, p gol.Params) []util.Cell {
+	file, err := os.Open(filename)
+	util.Check(err)
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(filename, ".gz") {
+		r, err = gzip.NewReader(file)
+		util.Check(err)
+		filename = strings.TrimSuffix(filename, ".gz")
+	}
+
+	var cells []util.Cell
+	switch filepath.Ext(filename) {
+	case ".rle":
+		pattern, err := util.ParseRLE(r)
+		util.Check(err)
+		if pattern.Width != p.ImageWidth || pattern.Height != p.ImageHeight {
+			t.Errorf("expected a %dx%d pattern, got %dx%d", p.ImageWidth, p.ImageHeight, pattern.Width, pattern.Height)
+		}
+		cells = pattern.Cells
+	case ".png":
+		img, err := png.Decode(r)
+		util.Check(err)
+		if size := img.Bounds().Size(); size.X != p.ImageWidth*p.CellSize || size.Y != p.ImageHeight*p.CellSize {
+			t.Fatalf("expected a %dx%d png, got %dx%d", p.ImageWidth*p.CellSize, p.ImageHeight*p.CellSize, size.X, size.Y)
+		}
+		alive, dead := color.RGBA{R: 0xff, A: 0xff}, color.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xff}
+		for y := 0; y < img.Bounds().Dy(); y++ {
+			for x := 0; x < img.Bounds().Dx(); x++ {
+				switch color.RGBAModel.Convert(img.At(x, y)) {
+				case alive:
+					// Count each cell once, from the top left pixel of its square
+					if x%p.CellSize == 0 && y%p.CellSize == 0 {
+						cells = append(cells, util.Cell{X: x / p.CellSize, Y: y / p.CellSize})
+					}
+				case dead:
+				default:
+					t.Fatalf("expected only the alive and dead colours, got %v at (%d, %d)", img.At(x, y), x, y)
+				}
+			}
+		}
+	default:
+		// Plain images have a value for each cell after the header, which has a maxval in P2 but not in P1
+		data, err := ioutil.ReadAll(r)
+		util.Check(err)
+		fields := strings.Fields(string(data))
+		var values []string
+		switch fields[0] {
+		case "P1":
+			values = strings.Split(strings.Join(fields[3:], ""), "")
+		case "P2":
+			values = fields[4:]
+		default:
+			t.Fatalf("expected a plain P1 or P2 image, got %v", fields[0])
+		}
+		if len(values) != p.ImageWidth*p.ImageHeight {
+			t.Fatalf("expected %d values in %v, got %d", p.ImageWidth*p.ImageHeight, filename, len(values))
+		}
+		for i, value := range values {
+			if value == "1" || value == "255" {
+				cells = append(cells, util.Cell{X: i % p.ImageWidth, Y: i / p.ImageWidth})
+			}
+		}
+	}
+	return cells
+}
+
+// TestOutput writes the final image of 100 turns of the 64x64 image in every format, picked by -format or by the
+// extension of -output, and reads it back to check it against the expected image.
+func TestOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "output")
+	util.Check(err)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		output, format string
+		expected       string
+	}{
+		{"", "p2", "out/64x64x100.pgm"},
+		{"", "pbm", "out/64x64x100.pbm"},
+		{"", "rle.gz", "out/64x64x100.rle.gz"},
+		{"run.rle", "", "run-100.rle"},
+		{"run.pbm.gz", "", "run-100.pbm.gz"},
+		{"run.png", "", "run-100.png"},
+		{"run", "png.gz", "run-100.png.gz"},
+		{"run.png", "p2", "run-100.pgm"},
+	}
+	for _, test := range tests {
+		p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64,
+			Format: test.format, CellSize: 3, AliveColour: "ff0000", DeadColour: "#102030"}
+		if test.output != "" {
+			p.Output = filepath.Join(dir, test.output)
+			test.expected = filepath.Join(dir, test.expected)
+		}
+		t.Run(fmt.Sprintf("output=%v,format=%v", test.output, test.format), func(t *testing.T) {
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			var output gol.ImageOutputComplete
+			for event := range events {
+				if e, ok := event.(gol.ImageOutputComplete); ok {
+					output = e
+				}
+			}
+			if output.Filename != test.expected {
+				t.Fatalf("expected the image to be written to %v, got %v", test.expected, output.Filename)
+			}
+			expectedAlive := readAliveCells("check/images/64x64x100.pgm", p.ImageWidth, p.ImageHeight)
+			assertEqualBoard(t, readOutputCells(t, output.Filename, p), expectedAlive, p)
+		})
+	}
+
+	rle, err := ioutil.ReadFile(filepath.Join(dir, "run-100.rle"))
+	util.Check(err)
+	if !strings.HasPrefix(string(rle), "#N run-100\n#C Generation 100\nx = 64, y = 64, rule = B3/S23\n") {
+		t.Errorf("expected the RLE pattern to start with its name, generation and rule, got\n%v", string(rle))
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Runs the world and returns the alive cells at the end
+func runParams(p gol.Params) []util.Cell {
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	var cells []util.Cell
+	for event := range events {
+		if final, ok := event.(gol.FinalTurnComplete); ok {
+			cells = final.Alive
+		}
+	}
+	return cells
+}
+
+// TestPattern reads the glider in images/16x16.pgm from RLE and plaintext patterns placed at the same offset,
+// which should finish on the same images as the pgm. The HighLife replicator checks that the rule in an RLE header is used.
+// Patterns that are broken or don't fit in the world should give errors.
+func TestPattern(t *testing.T) {
+	for _, input := range []string{"patterns/glider.rle", "patterns/glider.cells"} {
+		for _, turns := range []int{0, 1, 100} {
+			p := gol.Params{Turns: turns, Threads: 4, ImageWidth: 16, ImageHeight: 16, Input: input, Offset: util.Cell{X: 3, Y: 5}}
+			t.Run(fmt.Sprintf("%v-%dx%dx%d", input, p.ImageWidth, p.ImageHeight, p.Turns), func(t *testing.T) {
+				expectedAlive := readAliveCells(
+					"check/images/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, p.Turns),
+					p.ImageWidth,
+					p.ImageHeight,
+				)
+				assertEqualBoard(t, runParams(p), expectedAlive, p)
+			})
+		}
+	}
+
+	t.Run("rule", func(t *testing.T) {
+		p := gol.Params{Turns: 12, Threads: 4, ImageWidth: 64, ImageHeight: 64, Input: "patterns/replicator.rle", Offset: util.Cell{X: 30, Y: 30}}
+		cells := runParams(p)
+		p.Input, p.Rule = "patterns/replicator.cells", "highlife"
+		assertEqualBoard(t, cells, runParams(p), p)
+		p.Rule = ""
+		if conway := runParams(p); len(conway) == len(cells) {
+			t.Errorf("expected the replicator to end up different under B3/S23, got %v alive cells both times", len(cells))
+		}
+	})
+
+	for name, test := range map[string]struct {
+		rle   string
+		error string
+	}{
+		"no header":      {"bo$2bo$3o!", "expected the form x = 3, y = 3"},
+		"bad character":  {"x = 3, y = 3\nbo$2bq$3o!", "unexpected 'q'"},
+		"outside header": {"x = 2, y = 2\nbo$2bo$3o!", "outside the 2x2 pattern"},
+		"bad rule":       {"x = 3, y = 3, rule = B9/S23\nbo$2bo$3o!", "invalid rule"},
+		"bounded rule":   {"x = 3, y = 3, rule = b3s23:T16,16\nbo$2bo$3o!", ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			pattern, err := util.ParseRLE(strings.NewReader(test.rle))
+			if test.error == "" {
+				if err != nil || pattern.Rule != "b3s23" || len(pattern.Cells) != 5 {
+					t.Errorf("expected a glider with rule b3s23, got %v with error %v", pattern, err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Errorf("expected an error containing %q, got %v", test.error, err)
+			}
+		})
+	}
+
+	glider, err := util.ReadPattern("patterns/glider.cells")
+	util.Check(err)
+	if _, err := glider.Place(16, 16, util.Cell{X: 14, Y: 0}); err == nil {
+		t.Error("expected an error placing a 3x3 pattern at (14, 0) in a 16x16 world")
+	}
+}
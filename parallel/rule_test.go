@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestRules tests the 64x64 image on 1, 10 and 100 turns of other Life-like rules using 1, 4, 8 and 16 worker threads.
+// The expected images are in check/rules/<name>.
+func TestRules(t *testing.T) {
+	rules := []string{"highlife", "daynight", "maze", "B36/S125"}
+	names := []string{"highlife", "daynight", "maze", "2x2"}
+	for i, rule := range rules {
+		p := gol.Params{ImageWidth: 64, ImageHeight: 64, Rule: rule}
+		for _, turns := range []int{1, 10, 100} {
+			p.Turns = turns
+			expectedAlive := readAliveCells(
+				"check/rules/"+names[i]+"/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns),
+				p.ImageWidth,
+				p.ImageHeight,
+			)
+			for _, threads := range []int{1, 4, 8, 16} {
+				p.Threads = threads
+				testName := fmt.Sprintf("%s-%dx%dx%d-%d", names[i], p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+				t.Run(testName, func(t *testing.T) {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					var cells []util.Cell
+					for event := range events {
+						switch e := event.(type) {
+						case gol.FinalTurnComplete:
+							cells = e.Alive
+						}
+					}
+					assertEqualBoard(t, cells, expectedAlive, p)
+				})
+			}
+		}
+	}
+}
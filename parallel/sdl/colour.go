@@ -0,0 +1,65 @@
+package sdl
+
+import "math"
+
+// colourMode is how the window colours cells
+type colourMode int
+
+const (
+	// Alive cells are white and dead ones black
+	plainColours colourMode = iota
+	// Alive cells go from yellow when they are born through orange and red to purple as they get older
+	ageColours
+	// Cells born in the last few turns are bright green and cells that died in them are red, both fading as time goes on
+	activityColours
+	colourModes
+)
+
+// Number of turns cells take to fade after being born or dying in the activity colours
+const activityTurns = 16
+
+// Colours alive cells pass through as they get older, at ages of 0, 3, 15 and 63 turns or more
+var ageStops = [][3]float64{{255, 240, 120}, {255, 150, 40}, {220, 50, 60}, {110, 60, 200}}
+
+func (m colourMode) String() string {
+	switch m {
+	case ageColours:
+		return "Age"
+	case activityColours:
+		return "Activity"
+	default:
+		return "Plain"
+	}
+}
+
+// Returns the colour of a cell as red, green and blue, given whether it is alive and how many turns ago it last flipped
+func (m colourMode) colour(alive bool, age int32) (byte, byte, byte) {
+	switch {
+	case m == ageColours && alive:
+		// Ages are spread out on a log scale, so that young cells can be told apart and old ones all look old
+		at := math.Min(math.Log2(float64(age)+1)/2, float64(len(ageStops)-1))
+		stop := int(at)
+		if stop == len(ageStops)-1 {
+			stop--
+		}
+		return mix(ageStops[stop], ageStops[stop+1], at-float64(stop))
+	case m == activityColours && alive:
+		faded := math.Min(float64(age)/activityTurns, 1)
+		return mix([3]float64{80, 255, 80}, [3]float64{170, 170, 170}, faded)
+	case m == activityColours && age < activityTurns:
+		faded := float64(age) / activityTurns
+		return mix([3]float64{200, 30, 30}, [3]float64{0, 0, 0}, faded)
+	case alive:
+		return 0xFF, 0xFF, 0xFF
+	default:
+		return 0, 0, 0
+	}
+}
+
+// Returns the colour part of the way from one colour to another
+func mix(from, to [3]float64, part float64) (byte, byte, byte) {
+	channel := func(i int) byte {
+		return byte(from[i] + (to[i]-from[i])*part)
+	}
+	return channel(0), channel(1), channel(2)
+}
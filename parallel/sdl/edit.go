@@ -0,0 +1,127 @@
+package sdl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Directory the patterns that can be stamped onto the world are loaded from
+const brushDirectory = "patterns"
+
+// brush is what clicking in the window does to the world while it is paused. The pen flips the cell clicked
+// and paints the cells dragged over the same way, and a pattern is stamped with its top left corner on the cell clicked.
+type brush struct {
+	name    string
+	pattern *util.Pattern
+}
+
+// Returns the pen followed by the patterns in the brush directory, which are picked with the number keys
+func loadBrushes() []brush {
+	brushes := []brush{{name: "pen"}}
+	files, err := ioutil.ReadDir(brushDirectory)
+	if err != nil {
+		return brushes
+	}
+	for _, file := range files {
+		if !util.IsPatternFile(file.Name()) {
+			continue
+		}
+		pattern, err := util.ReadPattern(filepath.Join(brushDirectory, file.Name()))
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		brushes = append(brushes, brush{name: file.Name(), pattern: &pattern})
+	}
+	return brushes
+}
+
+// editor turns clicks in the window into edits to the world, which are only made while it is paused
+type editor struct {
+	brushes []brush
+	brush   int
+	paused  bool
+	// Whether the pen is being dragged, whether it is making cells alive or dead, and the last cell it was over
+	drawing   bool
+	drawAlive bool
+	last      util.Cell
+}
+
+func newEditor() *editor {
+	return &editor{brushes: loadBrushes()}
+}
+
+// Picks the brush for a number key, where 0 is the pen
+func (e *editor) pick(n int) {
+	if n >= len(e.brushes) {
+		return
+	}
+	e.brush = n
+	fmt.Println("Brush:", e.brushes[n].name)
+}
+
+// Returns the edit for a click on a cell, given whether the cell is alive, or false if nothing is edited
+func (e *editor) press(cell util.Cell, alive bool) (util.Edit, bool) {
+	if !e.paused {
+		fmt.Println("Pause with p to edit the world")
+		return util.Edit{}, false
+	}
+	if pattern := e.brushes[e.brush].pattern; pattern != nil {
+		return pattern.Stamp(cell), true
+	}
+	e.drawing, e.drawAlive, e.last = true, !alive, cell
+	return e.pen([]util.Cell{cell}), true
+}
+
+// Returns the edit for dragging the pen onto a cell, which paints every cell on the way from the last one
+func (e *editor) drag(cell util.Cell) (util.Edit, bool) {
+	if !e.drawing || !e.paused || cell == e.last {
+		return util.Edit{}, false
+	}
+	cells := line(e.last, cell)
+	e.last = cell
+	return e.pen(cells), true
+}
+
+// Stops dragging the pen
+func (e *editor) release() {
+	e.drawing = false
+}
+
+// Returns the edit that paints cells with the pen
+func (e *editor) pen(cells []util.Cell) util.Edit {
+	if e.drawAlive {
+		return util.Edit{Alive: cells}
+	}
+	return util.Edit{Dead: cells}
+}
+
+// Returns the cells on the line from one cell to another, including both of them, so that fast drags don't leave gaps
+func line(from, to util.Cell) []util.Cell {
+	abs := func(n int) int {
+		if n < 0 {
+			return -n
+		}
+		return n
+	}
+	steps := abs(to.X - from.X)
+	if abs(to.Y-from.Y) > steps {
+		steps = abs(to.Y - from.Y)
+	}
+	// Moves i steps of the way from a to b, rounding to the nearest cell
+	along := func(a, b, i int) int {
+		d := (b - a) * i
+		if d < 0 {
+			return a - (-d*2+steps)/(steps*2)
+		}
+		return a + (d*2+steps)/(steps*2)
+	}
+	cells := []util.Cell{from}
+	for i := 1; i <= steps; i++ {
+		cells = append(cells, util.Cell{X: along(from.X, to.X, i), Y: along(from.Y, to.Y, i)})
+	}
+	return cells
+}
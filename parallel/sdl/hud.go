@@ -0,0 +1,63 @@
+package sdl
+
+import (
+	"fmt"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// How long turns are counted for each time the turns a second is worked out again
+const rateInterval = 500 * time.Millisecond
+
+// hud keeps what the overlay shows up to date from the events: the turn, how fast turns are being made and the state
+type hud struct {
+	shown bool
+	turn  int
+	state gol.State
+	// Turns a second over the last interval, and the time and turn the current one started on, which is zero until
+	// the first turn after starting or carrying on
+	rate      float64
+	since     time.Time
+	sinceTurn int
+}
+
+func newHud() *hud {
+	return &hud{shown: true, state: gol.Executing}
+}
+
+// Counts a completed turn
+func (h *hud) complete(turn int) {
+	h.turn = turn
+	if h.since.IsZero() {
+		h.since, h.sinceTurn = time.Now(), turn
+		return
+	}
+	if elapsed := time.Since(h.since); elapsed >= rateInterval {
+		h.rate = float64(turn-h.sinceTurn) / elapsed.Seconds()
+		h.since, h.sinceTurn = time.Now(), turn
+	}
+}
+
+// Takes a change of state, which starts counting turns again
+func (h *hud) change(state gol.State, turn int) {
+	h.state, h.turn = state, turn
+	h.rate, h.since = 0, time.Time{}
+}
+
+// Returns the lines of the overlay, or none when it is hidden
+func (h *hud) lines(alive int, colours colourMode) []string {
+	if !h.shown {
+		return nil
+	}
+	lines := []string{
+		fmt.Sprintf("Turn %d", h.turn),
+		fmt.Sprintf("Alive %d", alive),
+		fmt.Sprintf("%.1f turns/s", h.rate),
+		h.state.String(),
+	}
+	if colours != plainColours {
+		lines = append(lines, "Colours: "+colours.String())
+	}
+	return lines
+}
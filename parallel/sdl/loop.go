@@ -2,12 +2,62 @@ package sdl
 
 import (
 	"fmt"
+	"math"
+
 	"github.com/veandco/go-sdl2/sdl"
 	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
 )
 
-func Run(p gol.Params, events <-chan gol.Event, keyPresses chan<- rune) {
-	w := NewWindow(int32(p.ImageWidth), int32(p.ImageHeight))
+// Runs the window, with cells scale pixels across, or zoomed to fit the world on the screen if scale is 0.
+// The mouse wheel and + and - zoom, dragging with the right or middle button or the arrow keys move around the world,
+// clicking the minimap moves to that part of it, and z fits the whole world in the window again.
+// The overlay showing the turn, alive cells, speed and state is hidden with h, and m changes how cells are coloured.
+func Run(p gol.Params, scale float64, events <-chan gol.Event, keyPresses chan<- rune, edits chan<- util.Edit) {
+	w := NewScaledWindow(int32(p.ImageWidth), int32(p.ImageHeight), scale)
+	// The window shows part of the infinite plane, following the alive cells until f is pressed
+	var view *viewport
+	if p.Infinite {
+		view = newViewport()
+	}
+	// Clicks edit the world while it is paused, with the brush picked by the number keys
+	edit := newEditor()
+	// Returns the cell under a point in the window, and whether it is alive
+	cellAt := func(x, y int32) (util.Cell, bool) {
+		pixelX, pixelY := w.CellAt(x, y)
+		if view != nil {
+			cell := util.Cell{X: view.x + pixelX, Y: view.y + pixelY}
+			_, alive := view.alive[cell]
+			return cell, alive
+		}
+		return util.Cell{X: pixelX, Y: pixelY}, w.PixelAlive(pixelX, pixelY)
+	}
+	// Edits are dropped rather than holding up the window if the world isn't taking them
+	send := func(e util.Edit, ok bool) {
+		if !ok {
+			return
+		}
+		select {
+		case edits <- e:
+		default:
+			fmt.Println("Edit dropped, the world is busy")
+		}
+	}
+	// Whether the world is being dragged with the right or middle button, or the view moved around the minimap
+	panning, minimapping := false, false
+	// The window is drawn again between turns, and whenever cells flip while the world is paused or the view moves
+	changed := false
+	stats := newHud()
+	// Draws the window with the overlay up to date
+	render := func() {
+		alive := w.AliveCount()
+		if view != nil {
+			alive = len(view.alive)
+		}
+		w.SetOverlay(stats.lines(alive, w.colours))
+		w.RenderFrame()
+		changed = false
+	}
 
 sdlLoop:
 	for {
@@ -24,7 +74,83 @@ sdlLoop:
 					keyPresses <- 'q'
 				case sdl.K_k:
 					keyPresses <- 'k'
+				case sdl.K_c:
+					keyPresses <- 'c'
+				case sdl.K_EQUALS, sdl.K_PLUS, sdl.K_KP_PLUS:
+					w.ZoomCentre(2)
+					changed = true
+				case sdl.K_MINUS, sdl.K_KP_MINUS:
+					w.ZoomCentre(0.5)
+					changed = true
+				case sdl.K_z:
+					w.Fit()
+					changed = true
+				case sdl.K_h:
+					stats.shown = !stats.shown
+					changed = true
+				case sdl.K_m:
+					fmt.Println("Colours:", w.NextColours())
+					changed = true
+				case sdl.K_UP:
+					w.Pan(0, w.screenHeight/8)
+					changed = true
+				case sdl.K_DOWN:
+					w.Pan(0, -w.screenHeight/8)
+					changed = true
+				case sdl.K_LEFT:
+					w.Pan(w.screenWidth/8, 0)
+					changed = true
+				case sdl.K_RIGHT:
+					w.Pan(-w.screenWidth/8, 0)
+					changed = true
+				case sdl.K_f:
+					if view != nil {
+						view.follow = !view.follow
+					}
+				default:
+					if e.Keysym.Sym >= sdl.K_0 && e.Keysym.Sym <= sdl.K_9 {
+						edit.pick(int(e.Keysym.Sym - sdl.K_0))
+					}
+				}
+			case *sdl.MouseButtonEvent:
+				pressed := e.Type == sdl.MOUSEBUTTONDOWN
+				switch {
+				case e.Button == sdl.BUTTON_RIGHT || e.Button == sdl.BUTTON_MIDDLE:
+					panning = pressed
+				case e.Button == sdl.BUTTON_LEFT && pressed && w.CentreOnMinimap(e.X, e.Y):
+					minimapping = true
+					changed = true
+				case e.Button == sdl.BUTTON_LEFT && pressed:
+					send(edit.press(cellAt(e.X, e.Y)))
+				case e.Button == sdl.BUTTON_LEFT:
+					minimapping = false
+					edit.release()
+				}
+			case *sdl.MouseMotionEvent:
+				switch {
+				case panning:
+					w.Pan(e.XRel, e.YRel)
+					changed = true
+				case minimapping:
+					w.CentreOnMinimap(e.X, e.Y)
+					changed = true
+				default:
+					cell, _ := cellAt(e.X, e.Y)
+					send(edit.drag(cell))
+				}
+			case *sdl.MouseWheelEvent:
+				steps := float64(e.Y)
+				if e.Direction == sdl.MOUSEWHEEL_FLIPPED {
+					steps = -steps
+				}
+				x, y, _ := sdl.GetMouseState()
+				w.Zoom(math.Exp2(steps), x, y)
+				changed = true
+			case *sdl.WindowEvent:
+				if e.Event == sdl.WINDOWEVENT_SIZE_CHANGED {
+					w.Resize()
 				}
+				changed = true
 			}
 		}
 		select {
@@ -35,19 +161,39 @@ sdlLoop:
 			}
 			switch e := event.(type) {
 			case gol.CellFlipped:
-				w.FlipPixel(e.Cell.X, e.Cell.Y)
+				w.SetTurn(e.CompletedTurns)
+				if view != nil {
+					view.flip(w, e.Cell)
+				} else {
+					w.FlipPixel(e.Cell.X, e.Cell.Y)
+				}
+				if edit.paused {
+					changed = true
+				}
 			case gol.TurnComplete:
-				w.RenderFrame()
+				w.SetTurn(e.CompletedTurns)
+				stats.complete(e.CompletedTurns)
+				if view != nil {
+					view.update(w)
+				}
+				render()
 			case gol.FinalTurnComplete:
 				w.Destroy()
 				break sdlLoop
+			case gol.StateChange:
+				edit.paused = e.NewState == gol.Paused
+				stats.change(e.NewState, e.CompletedTurns)
+				changed = true
+				fmt.Printf("Completed Turns %-8v%v\n", event.GetCompletedTurns(), event)
 			default:
 				if len(event.String()) > 0 {
 					fmt.Printf("Completed Turns %-8v%v\n", event.GetCompletedTurns(), event)
 				}
 			}
 		default:
-			break
+			if changed {
+				render()
+			}
 		}
 	}
 
@@ -0,0 +1,106 @@
+package sdl
+
+import (
+	"github.com/veandco/go-sdl2/sdl"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Largest number of pixels along each side of the minimap, and its distance from the corner of the window
+const (
+	minimapSize   = 128
+	minimapMargin = 8
+)
+
+// minimap is a small picture of the whole world, shown in the corner of the window when only part of it is in view.
+// Each of its pixels covers a square block of cells and is shaded by how many of them are alive.
+// The blocks are kept up to date as cells flip, so drawing it costs the same however big the world is.
+type minimap struct {
+	texture       *sdl.Texture
+	width, height int32
+	// Cells along each side of a block
+	block  int32
+	alive  []int32
+	pixels []byte
+}
+
+func newMinimap(renderer *sdl.Renderer, worldWidth, worldHeight int32) *minimap {
+	longest := worldWidth
+	if worldHeight > longest {
+		longest = worldHeight
+	}
+	block := (longest + minimapSize - 1) / minimapSize
+	width, height := (worldWidth+block-1)/block, (worldHeight+block-1)/block
+	texture, err := renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STATIC, width, height)
+	util.Check(err)
+	m := &minimap{
+		texture: texture,
+		width:   width,
+		height:  height,
+		block:   block,
+		alive:   make([]int32, width*height),
+		pixels:  make([]byte, width*height*4),
+	}
+	m.clear()
+	return m
+}
+
+func (m *minimap) destroy() {
+	err := m.texture.Destroy()
+	util.Check(err)
+}
+
+// Adds a cell that has come alive, or takes away one that has died when n is -1, from the shade of its block
+func (m *minimap) add(x, y int, n int32) {
+	i := (int32(y)/m.block)*m.width + int32(x)/m.block
+	m.alive[i] += n
+	// A single alive cell shows up, and blocks get brighter as more of their cells are alive
+	shade := byte(0)
+	if m.alive[i] > 0 {
+		shade = byte(0x60 + 0x9F*m.alive[i]/(m.block*m.block))
+	}
+	m.pixels[4*i+0] = shade
+	m.pixels[4*i+1] = shade
+	m.pixels[4*i+2] = shade
+}
+
+// Makes every block dead
+func (m *minimap) clear() {
+	for i := range m.alive {
+		m.alive[i] = 0
+		m.pixels[4*i+0] = 0
+		m.pixels[4*i+1] = 0
+		m.pixels[4*i+2] = 0
+		m.pixels[4*i+3] = 0xFF
+	}
+}
+
+// Returns the size of the minimap scaled to fit a square with sides of a number of pixels
+func (m *minimap) size(side int32) sdl.Rect {
+	longest := m.width
+	if m.height > longest {
+		longest = m.height
+	}
+	return sdl.Rect{W: m.width * side / longest, H: m.height * side / longest}
+}
+
+// Draws the minimap in an area of the window, outlining the cells of the world that are in view
+func (m *minimap) draw(renderer *sdl.Renderer, area, view sdl.Rect, worldWidth, worldHeight int32) {
+	err := m.texture.Update(nil, m.pixels, int(m.width*4))
+	util.Check(err)
+	err = renderer.Copy(m.texture, nil, &area)
+	util.Check(err)
+	err = renderer.SetDrawColor(0x80, 0x80, 0x80, 0xFF)
+	util.Check(err)
+	err = renderer.DrawRect(&sdl.Rect{X: area.X - 1, Y: area.Y - 1, W: area.W + 2, H: area.H + 2})
+	util.Check(err)
+	outline := sdl.Rect{
+		X: area.X + view.X*area.W/worldWidth,
+		Y: area.Y + view.Y*area.H/worldHeight,
+		W: view.W*area.W/worldWidth + 1,
+		H: view.H*area.H/worldHeight + 1,
+	}
+	err = renderer.SetDrawColor(0xFF, 0xC0, 0x00, 0xFF)
+	util.Check(err)
+	err = renderer.DrawRect(&outline)
+	util.Check(err)
+}
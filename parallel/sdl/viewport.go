@@ -0,0 +1,84 @@
+package sdl
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// viewport is the part of the infinite plane shown in the window, which can follow the alive cells as they move.
+// It keeps every alive cell and the turn it was born on, so that the window can be drawn again when it moves.
+type viewport struct {
+	// Cell of the plane in the top left corner of the window
+	x, y   int
+	follow bool
+	alive  map[util.Cell]int
+}
+
+func newViewport() *viewport {
+	return &viewport{follow: true, alive: make(map[util.Cell]int)}
+}
+
+// Returns whether a cell of the plane is in the window
+func (v *viewport) inView(w *Window, cell util.Cell) bool {
+	return cell.X >= v.x && cell.Y >= v.y && cell.X < v.x+int(w.Width) && cell.Y < v.y+int(w.Height)
+}
+
+// Flips a cell of the plane, and its pixel if it is in the window
+func (v *viewport) flip(w *Window, cell util.Cell) {
+	if _, alive := v.alive[cell]; alive {
+		delete(v.alive, cell)
+	} else {
+		v.alive[cell] = int(w.turn)
+	}
+	if v.inView(w, cell) {
+		w.FlipPixel(cell.X-v.x, cell.Y-v.y)
+	}
+}
+
+// Moves the window over the alive cells when some of them are out of view and draws it again.
+// When the alive cells don't fit in the window, it only moves once their middle leaves the middle half of the window.
+func (v *viewport) update(w *Window) {
+	if !v.follow || len(v.alive) == 0 {
+		return
+	}
+	first := true
+	var minX, minY, maxX, maxY int
+	for cell := range v.alive {
+		if first || cell.X < minX {
+			minX = cell.X
+		}
+		if first || cell.X > maxX {
+			maxX = cell.X
+		}
+		if first || cell.Y < minY {
+			minY = cell.Y
+		}
+		if first || cell.Y > maxY {
+			maxY = cell.Y
+		}
+		first = false
+	}
+
+	width, height := int(w.Width), int(w.Height)
+	middleX, middleY := minX+(maxX-minX)/2, minY+(maxY-minY)/2
+	if maxX-minX < width && maxY-minY < height {
+		if minX >= v.x && minY >= v.y && maxX < v.x+width && maxY < v.y+height {
+			return
+		}
+	} else if abs(middleX-(v.x+width/2)) < width/4 && abs(middleY-(v.y+height/2)) < height/4 {
+		return
+	}
+
+	v.x, v.y = middleX-width/2, middleY-height/2
+	w.ClearPixels()
+	for cell, born := range v.alive {
+		if v.inView(w, cell) {
+			w.SetPixel(cell.X-v.x, cell.Y-v.y)
+			w.SetPixelFlipped(cell.X-v.x, cell.Y-v.y, born)
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// A glider heading down and to the right, which moves one cell diagonally every 4 turns
+var glider = []util.Cell{{X: 1, Y: 0}, {X: 2, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}, {X: 2, Y: 2}}
+
+// Makes a world with a glider at each of the given top left corners, wrapping around the edges
+func gliderWorld(width, height int, corners []util.Cell) util.BitGrid {
+	world := util.NewBitGrid(width, height)
+	for _, corner := range corners {
+		for _, cell := range glider {
+			world.Rows[(corner.Y+cell.Y)%height].Set((corner.X+cell.X)%width, true)
+		}
+	}
+	return world
+}
+
+// Saves a world as a checkpoint on turn 0 so that it can be run with Resume, and returns the filename
+func writeWorld(p gol.Params, world util.BitGrid) string {
+	file, err := ioutil.TempFile("", "*.checkpoint")
+	util.Check(err)
+	util.Check(file.Close())
+	util.Check(util.WriteCheckpoint(file.Name(), util.Checkpoint{
+		Turns:       p.Turns,
+		Threads:     p.Threads,
+		ImageWidth:  p.ImageWidth,
+		ImageHeight: p.ImageHeight,
+		Rule:        p.Rule,
+		Topology:    p.Topology,
+		World:       world,
+	}))
+	return file.Name()
+}
+
+// Runs a world from a checkpoint and returns the alive cells at the end
+func runWorld(filename string, threads int) []util.Cell {
+	events := make(chan gol.Event)
+	go gol.Run(gol.Params{Threads: threads, Resume: filename}, events, nil)
+	var cells []util.Cell
+	for event := range events {
+		if final, ok := event.(gol.FinalTurnComplete); ok {
+			cells = final.Alive
+		}
+	}
+	return cells
+}
+
+// Works out the next state of a world one cell at a time, to check the tiled workers against
+func naiveNext(p gol.Params, rule util.Rule, world util.BitGrid) util.BitGrid {
+	next := util.NewBitGrid(p.ImageWidth, p.ImageHeight)
+	for y := 0; y < p.ImageHeight; y++ {
+		for x := 0; x < p.ImageWidth; x++ {
+			neighbours := 0
+			for j := -1; j < 2; j++ {
+				for i := -1; i < 2; i++ {
+					c, r, inside := p.Topology.Resolve(x+i, y+j, p.ImageWidth, p.ImageHeight)
+					if (i != 0 || j != 0) && inside && world.Rows[r].Get(c) {
+						neighbours++
+					}
+				}
+			}
+			next.Rows[y].Set(x, rule.Next(world.Rows[y].Get(x), neighbours))
+		}
+	}
+	return next
+}
+
+// TestTiles runs sparse worlds of gliders, which only ever have a few active tiles,
+// with gliders crossing the edges of tiles, strips and the world.
+// On a torus the gliders should end up moved on by a quarter of the number of turns,
+// and on the other topologies the world should match working it out one cell at a time.
+func TestTiles(t *testing.T) {
+	corners := []util.Cell{{X: 0, Y: 0}, {X: 62, Y: 14}, {X: 130, Y: 40}, {X: 280, Y: 90}, {X: 298, Y: 50}}
+
+	for _, threads := range []int{1, 3, 8, 16} {
+		p := gol.Params{Turns: 400, Threads: threads, ImageWidth: 300, ImageHeight: 100}
+		t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", p.Topology, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			filename := writeWorld(p, gliderWorld(p.ImageWidth, p.ImageHeight, corners))
+			defer os.Remove(filename)
+			var moved []util.Cell
+			for _, corner := range corners {
+				moved = append(moved, util.Cell{X: corner.X + p.Turns/4, Y: corner.Y + p.Turns/4})
+			}
+			expected := gliderWorld(p.ImageWidth, p.ImageHeight, moved)
+			assertEqualBoard(t, runWorld(filename, p.Threads), expected.AliveCells(), p)
+		})
+	}
+
+	rule, err := util.ParseRule("")
+	util.Check(err)
+	for _, topology := range []util.Topology{util.Bounded, util.Reflect, util.KleinBottle, util.ProjectivePlane} {
+		p := gol.Params{Turns: 150, Threads: 5, ImageWidth: 200, ImageHeight: 100, Topology: topology}
+		t.Run(fmt.Sprintf("%v-%dx%dx%d-%d", p.Topology, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads), func(t *testing.T) {
+			world := gliderWorld(p.ImageWidth, p.ImageHeight, []util.Cell{{X: 60, Y: 10}, {X: 150, Y: 60}, {X: 190, Y: 30}})
+			filename := writeWorld(p, world)
+			defer os.Remove(filename)
+			for turn := 0; turn < p.Turns; turn++ {
+				world = naiveNext(p, rule, world)
+			}
+			assertEqualBoard(t, runWorld(filename, p.Threads), world.AliveCells(), p)
+		})
+	}
+}
+
+// BenchmarkSparse runs a 4096x4096 world with a few gliders in it, where almost every tile is skipped
+func BenchmarkSparse(b *testing.B) {
+	p := gol.Params{Turns: benchLength, Threads: 8, ImageWidth: 4096, ImageHeight: 4096}
+	var corners []util.Cell
+	for i := 0; i < 16; i++ {
+		corners = append(corners, util.Cell{X: i * 256, Y: i * 97})
+	}
+	filename := writeWorld(p, gliderWorld(p.ImageWidth, p.ImageHeight, corners))
+	defer os.Remove(filename)
+	os.Stdout = nil // Disable all program output apart from benchmark results
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runWorld(filename, p.Threads)
+	}
+}
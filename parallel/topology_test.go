@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestTopology tests 16x16 and 64x64 images on 1 and 100 turns using 1-16 worker threads,
+// for every topology other than the torus, which is covered by TestGol.
+// The expected images are in check/topology/<topology>.
+func TestTopology(t *testing.T) {
+	topologies := []util.Topology{util.Bounded, util.Reflect, util.KleinBottle, util.ProjectivePlane}
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16},
+		{ImageWidth: 64, ImageHeight: 64},
+	}
+	for _, topology := range topologies {
+		for _, p := range tests {
+			p.Topology = topology
+			for _, turns := range []int{1, 100} {
+				p.Turns = turns
+				expectedAlive := readAliveCells(
+					"check/topology/"+topology.String()+"/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns),
+					p.ImageWidth,
+					p.ImageHeight,
+				)
+				for threads := 1; threads <= 16; threads++ {
+					p.Threads = threads
+					testName := fmt.Sprintf("%v-%dx%dx%d-%d", topology, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+					t.Run(testName, func(t *testing.T) {
+						events := make(chan gol.Event)
+						go gol.Run(p, events, nil)
+						var cells []util.Cell
+						for event := range events {
+							switch e := event.(type) {
+							case gol.FinalTurnComplete:
+								cells = e.Alive
+							}
+						}
+						assertEqualBoard(t, cells, expectedAlive, p)
+					})
+				}
+			}
+		}
+	}
+}
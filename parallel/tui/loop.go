@@ -0,0 +1,127 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// How often the terminal is drawn again while the world is changing
+const frameTime = 50 * time.Millisecond
+
+// How often the size of the terminal is checked, so that the view follows it being resized
+const sizeTime = time.Second
+
+// Terminal is where Show draws the world and reads keys from.
+type Terminal struct {
+	In  io.Reader
+	Out io.Writer
+	// Size returns the columns and rows of the terminal
+	Size func() (int, int)
+}
+
+// Run shows the world in the terminal instead of an SDL window, so that a run can be watched and driven over SSH.
+// It puts the terminal into raw mode until the run has finished.
+func Run(p gol.Params, events <-chan gol.Event, keyPresses chan<- rune) {
+	restore := makeRaw()
+	defer restore()
+	// Clear the terminal and hide the cursor while drawing, then leave the last frame on the terminal
+	fmt.Print("\x1b[2J\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\r\n")
+	Terminal{In: os.Stdin, Out: os.Stdout, Size: terminalSize}.Show(p, events, keyPresses)
+}
+
+// Show draws the world from the events until the final turn is complete or the events are closed.
+// p, s, c, q and k are sent to keyPresses, and Ctrl-C is sent as q. The arrow keys scroll, + and - zoom,
+// 0 zooms out to fit the world and b switches between half blocks and braille.
+func (t Terminal) Show(p gol.Params, events <-chan gol.Event, keyPresses chan<- rune) {
+	keys := make(chan rune)
+	done := make(chan struct{})
+	defer close(done)
+	go readKeys(t.In, keys, done)
+
+	columns, rows := t.Size()
+	s := newScreen(p, columns, rows)
+	s.fit()
+	frames := time.NewTicker(frameTime)
+	defer frames.Stop()
+	sized := time.Now()
+	changed := true
+
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				// The input has ended, but the run can still be watched
+				keys = nil
+				break
+			}
+			switch key {
+			case 'p', 's', 'c', 'q', 'k':
+				keyPresses <- key
+			case interrupt:
+				keyPresses <- 'q'
+			case arrowUp:
+				s.scroll(0, -1)
+			case arrowDown:
+				s.scroll(0, 1)
+			case arrowLeft:
+				s.scroll(-1, 0)
+			case arrowRight:
+				s.scroll(1, 0)
+			case '+', '=':
+				s.zoom(s.scale / 2)
+			case '-':
+				s.zoom(s.scale * 2)
+			case '0':
+				s.fit()
+			case 'b':
+				s.braille = !s.braille
+				s.clamp()
+			}
+			changed = true
+		case event, ok := <-events:
+			if !ok {
+				s.draw(t.Out)
+				return
+			}
+			switch e := event.(type) {
+			case gol.CellFlipped:
+				s.flip(e.Cell)
+				changed = true
+			case gol.TurnComplete:
+				s.turn = e.CompletedTurns
+				changed = true
+			case gol.FinalTurnComplete:
+				s.turn = e.CompletedTurns
+				s.draw(t.Out)
+				return
+			case gol.StateChange:
+				s.state = e.NewState.String()
+				changed = true
+			case gol.AliveCellsCount:
+				// The screen counts the alive cells itself
+			default:
+				if len(event.String()) > 0 {
+					s.message = event.String()
+					changed = true
+				}
+			}
+		case <-frames.C:
+			if time.Since(sized) > sizeTime {
+				if s.resize(t.Size()) {
+					_, _ = io.WriteString(t.Out, "\x1b[2J")
+					changed = true
+				}
+				sized = time.Now()
+			}
+			if changed {
+				s.draw(t.Out)
+				changed = false
+			}
+		}
+	}
+}
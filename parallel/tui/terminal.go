@@ -0,0 +1,81 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Runes for the arrow keys, which the terminal sends as escape sequences. They are past the last Unicode code point.
+const (
+	arrowUp rune = 0x110000 + iota
+	arrowDown
+	arrowRight
+	arrowLeft
+)
+
+// Ctrl-C, which raw mode sends as a key instead of interrupting the program
+const interrupt = '\x03'
+
+// Runs stty on the terminal, returning what it prints
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// Puts the terminal into raw mode, so that keys are read as soon as they are pressed without being echoed.
+// Returns a function that puts the terminal back how it was, which does nothing if stdin isn't a terminal.
+func makeRaw() func() {
+	saved, err := stty("-g")
+	if err != nil {
+		return func() {}
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return func() {}
+	}
+	return func() {
+		_, _ = stty(saved)
+	}
+}
+
+// Returns the columns and rows of the terminal, or 80x24 when its size can't be found
+func terminalSize() (int, int) {
+	var rows, columns int
+	if out, err := stty("size"); err == nil {
+		if _, err := fmt.Sscan(out, &rows, &columns); err == nil && rows > 0 && columns > 0 {
+			return columns, rows
+		}
+	}
+	return 80, 24
+}
+
+// Reads keys until the input ends or done is closed, turning the escape sequences of the arrow keys into arrow runes.
+// The keys channel is closed when the input ends.
+func readKeys(in io.Reader, keys chan<- rune, done <-chan struct{}) {
+	reader := bufio.NewReader(in)
+	for {
+		r, _, err := reader.ReadRune()
+		if err != nil {
+			close(keys)
+			return
+		}
+		// An arrow key is ESC [ A to ESC [ D, or ESC O A to ESC O D in application mode
+		if r == '\x1b' && reader.Buffered() >= 2 {
+			sequence, _ := reader.Peek(2)
+			if (sequence[0] == '[' || sequence[0] == 'O') && sequence[1] >= 'A' && sequence[1] <= 'D' {
+				r = arrowUp + rune(sequence[1]-'A')
+				_, _ = reader.Discard(2)
+			}
+		}
+		select {
+		case keys <- r:
+		case <-done:
+			return
+		}
+	}
+}
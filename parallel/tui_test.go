@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/tui"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Runs the Game of Life shown on a terminal of 80x24 that reads keys from input, returning everything drawn on it
+func runTerminal(p gol.Params, input string) string {
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune, 10)
+	go gol.Run(p, events, keyPresses)
+	var out bytes.Buffer
+	terminal := tui.Terminal{In: strings.NewReader(input), Out: &out, Size: func() (int, int) { return 80, 24 }}
+	terminal.Show(p, events, keyPresses)
+	// Let the run finish after the final turn, as main does
+	for range events {
+	}
+	return out.String()
+}
+
+// Decodes the half blocks of the last frame drawn on the terminal back into the dots that are alive
+func terminalDots(out string) []util.Cell {
+	frames := strings.Split(out, "\x1b[H")
+	lines := strings.Split(frames[len(frames)-1], "\r\n")
+	var dots []util.Cell
+	for y, line := range lines[:len(lines)-2] {
+		for x, r := range []rune(strings.TrimSuffix(line, "\x1b[K")) {
+			if r == '▀' || r == '█' {
+				dots = append(dots, util.Cell{X: x, Y: 2 * y})
+			}
+			if r == '▄' || r == '█' {
+				dots = append(dots, util.Cell{X: x, Y: 2*y + 1})
+			}
+		}
+	}
+	return dots
+}
+
+// TestTui shows runs on a terminal, checking that the last frame drawn is the final turn. The 512x512 world is too
+// large for the terminal, so it is zoomed out to 16 cells a dot, where a dot is alive if any of its cells are.
+// A q read from the terminal should stop a run that would otherwise go on for a long time.
+func TestTui(t *testing.T) {
+	for _, test := range []struct {
+		size, scale int
+	}{{16, 1}, {512, 16}} {
+		p := gol.Params{Turns: 100, Threads: 8, ImageWidth: test.size, ImageHeight: test.size}
+		t.Run(fmt.Sprintf("%dx%d", test.size, test.size), func(t *testing.T) {
+			out := runTerminal(p, "")
+			if !strings.Contains(out, "Turn 100 ") {
+				t.Errorf("expected the status line to show turn 100")
+			}
+			expectedDots := make(map[util.Cell]bool)
+			for _, cell := range readAliveCells(fmt.Sprintf("check/images/%vx%vx100.pgm", p.ImageWidth, p.ImageHeight), p.ImageWidth, p.ImageHeight) {
+				expectedDots[util.Cell{X: cell.X / test.scale, Y: cell.Y / test.scale}] = true
+			}
+			var expected []util.Cell
+			for dot := range expectedDots {
+				expected = append(expected, dot)
+			}
+			dotsParams := gol.Params{ImageWidth: test.size / test.scale, ImageHeight: test.size / test.scale}
+			assertEqualBoard(t, terminalDots(out), expected, dotsParams)
+		})
+	}
+
+	t.Run("keys", func(t *testing.T) {
+		p := gol.Params{Turns: 1000000000, Threads: 8, ImageWidth: 64, ImageHeight: 64}
+		done := make(chan bool)
+		go func() {
+			// The other keys only move the view, so the q after them stops the run
+			runTerminal(p, "\x1b[B\x1b[Cb-+0q")
+			done <- true
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("expected q to stop the run")
+		}
+	})
+}
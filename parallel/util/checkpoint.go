@@ -0,0 +1,79 @@
+package util
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Checkpoint is the full state of a simulation, so that it can be carried on from the turn it got to.
+type Checkpoint struct {
+	CompletedTurns int
+	// Parameters the simulation was started with, Turns is the total number of turns to run
+	Turns       int
+	Threads     int
+	ImageWidth  int
+	ImageHeight int
+	Rule        string
+	Topology    Topology
+	// Id of the session on the distributed broker, empty for the parallel implementation
+	Session string
+	World   BitGrid
+}
+
+// WriteCheckpoint saves a checkpoint as gzipped gob.
+// It is written to a temporary file that replaces the old checkpoint, so a crash never leaves half a checkpoint behind.
+func WriteCheckpoint(filename string, checkpoint Checkpoint) error {
+	temp, err := os.Create(filepath.Join(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp"))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	zipped := gzip.NewWriter(temp)
+	err = gob.NewEncoder(zipped).Encode(checkpoint)
+	if err == nil {
+		err = zipped.Close()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), filename)
+}
+
+// ReadCheckpoint loads a checkpoint saved by WriteCheckpoint and checks that the world matches its size.
+func ReadCheckpoint(filename string) (Checkpoint, error) {
+	var checkpoint Checkpoint
+	file, err := os.Open(filename)
+	if err != nil {
+		return checkpoint, err
+	}
+	defer file.Close()
+
+	zipped, err := gzip.NewReader(file)
+	if err != nil {
+		return checkpoint, fmt.Errorf("%s is not a checkpoint: %v", filename, err)
+	}
+	err = gob.NewDecoder(zipped).Decode(&checkpoint)
+	if err != nil {
+		return checkpoint, fmt.Errorf("%s is not a checkpoint: %v", filename, err)
+	}
+
+	world := checkpoint.World
+	if world.Width != checkpoint.ImageWidth || world.Height != checkpoint.ImageHeight || len(world.Rows) != world.Height {
+		return checkpoint, fmt.Errorf("checkpoint %s has a %dx%d world with %d rows, expected %dx%d",
+			filename, world.Width, world.Height, len(world.Rows), checkpoint.ImageWidth, checkpoint.ImageHeight)
+	}
+	for y, row := range world.Rows {
+		if len(row) != len(NewBitRow(world.Width)) {
+			return checkpoint, fmt.Errorf("row %d of checkpoint %s has %d words, expected %d", y, filename, len(row), len(NewBitRow(world.Width)))
+		}
+	}
+	_, err = ParseRule(checkpoint.Rule)
+	return checkpoint, err
+}
@@ -0,0 +1,106 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Longest line written in plain PBM and PGM images, as the netpbm formats recommend
+const plainLineLength = 70
+
+// WritePGM writes the grid as a PGM image with 255 for alive cells and 0 for dead ones,
+// either as binary P5 or as plain P2, where each cell is written out in ASCII.
+func WritePGM(w io.Writer, grid BitGrid, plain bool) error {
+	out := bufio.NewWriter(w)
+	if !plain {
+		fmt.Fprintf(out, "P5\n%d %d\n255\n", grid.Width, grid.Height)
+		for _, row := range grid.Unpack() {
+			out.Write(row)
+		}
+		return out.Flush()
+	}
+
+	fmt.Fprintf(out, "P2\n%d %d\n255\n", grid.Width, grid.Height)
+	for _, row := range grid.Rows {
+		line := 0
+		for x := 0; x < grid.Width; x++ {
+			value := "0"
+			if row.Get(x) {
+				value = "255"
+			}
+			if line > 0 && line+1+len(value) > plainLineLength {
+				out.WriteByte('\n')
+				line = 0
+			} else if line > 0 {
+				out.WriteByte(' ')
+				line++
+			}
+			out.WriteString(value)
+			line += len(value)
+		}
+		out.WriteByte('\n')
+	}
+	return out.Flush()
+}
+
+// WritePBM writes the grid as a plain P1 PBM image, where 1 is an alive cell and 0 a dead one.
+func WritePBM(w io.Writer, grid BitGrid) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "P1\n%d %d\n", grid.Width, grid.Height)
+	for _, row := range grid.Rows {
+		for x := 0; x < grid.Width; x++ {
+			if x > 0 && x%plainLineLength == 0 {
+				out.WriteByte('\n')
+			}
+			if row.Get(x) {
+				out.WriteByte('1')
+			} else {
+				out.WriteByte('0')
+			}
+		}
+		out.WriteByte('\n')
+	}
+	return out.Flush()
+}
+
+// WritePNG writes the grid as a PNG image with each cell drawn as a square of cellSize pixels in the alive or dead colour.
+func WritePNG(w io.Writer, grid BitGrid, cellSize int, alive, dead color.Color) error {
+	return png.Encode(w, PalettedImage(grid, cellSize, alive, dead))
+}
+
+// PalettedImage draws the grid with each cell as a square of cellSize pixels, in a palette of the dead and alive colours.
+func PalettedImage(grid BitGrid, cellSize int, alive, dead color.Color) *image.Paletted {
+	if cellSize < 1 {
+		cellSize = 1
+	}
+	img := image.NewPaletted(image.Rect(0, 0, grid.Width*cellSize, grid.Height*cellSize), color.Palette{dead, alive})
+	for y, row := range grid.Rows {
+		for x := 0; x < grid.Width; x++ {
+			if !row.Get(x) {
+				continue
+			}
+			for j := 0; j < cellSize; j++ {
+				for i := 0; i < cellSize; i++ {
+					img.SetColorIndex(x*cellSize+i, y*cellSize+j, 1)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// ParseColour parses a colour written in hex as rrggbb, optionally starting with #.
+func ParseColour(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q: expected the form rrggbb, e.g. ffffff for white", s)
+	}
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 0xff}, nil
+}
@@ -0,0 +1,115 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Topology decides what lies beyond the edges of the world.
+type Topology int
+
+// The zero value is the torus, so worlds wrap around unless told otherwise.
+const (
+	// Torus wraps the left edge to the right edge and the top edge to the bottom edge.
+	Torus Topology = iota
+	// Bounded treats every cell outside the world as dead.
+	Bounded
+	// Reflect mirrors the world at every edge, so the cell beyond an edge is the edge cell itself.
+	Reflect
+	// KleinBottle wraps left to right like a torus, but top and bottom are glued with a half twist.
+	KleinBottle
+	// ProjectivePlane glues both pairs of opposite edges with a half twist.
+	ProjectivePlane
+)
+
+var topologyNames = []string{"torus", "bounded", "reflect", "klein", "projective"}
+
+// Other names accepted by ParseTopology
+var topologyAliases = map[string]Topology{
+	"toroidal":        Torus,
+	"dead":            Bounded,
+	"mirror":          Reflect,
+	"kleinbottle":     KleinBottle,
+	"projectiveplane": ProjectivePlane,
+}
+
+// ParseTopology parses the name of a topology, e.g. "torus" or "klein". An empty string gives the torus.
+func ParseTopology(s string) (Topology, error) {
+	name := strings.ToLower(strings.Replace(strings.TrimSpace(s), " ", "", -1))
+	if name == "" {
+		return Torus, nil
+	}
+	for i, n := range topologyNames {
+		if n == name {
+			return Topology(i), nil
+		}
+	}
+	if t, ok := topologyAliases[name]; ok {
+		return t, nil
+	}
+	return Torus, fmt.Errorf("unknown topology %q: expected one of %v", s, strings.Join(topologyNames, ", "))
+}
+
+func (t Topology) String() string {
+	if t < 0 || int(t) >= len(topologyNames) {
+		return "Incorrect Topology"
+	}
+	return topologyNames[t]
+}
+
+// Set allows a Topology to be used as a command line flag.
+func (t *Topology) Set(s string) error {
+	topology, err := ParseTopology(s)
+	if err != nil {
+		return err
+	}
+	*t = topology
+	return nil
+}
+
+// Resolve maps the coordinates of a neighbour, which may be up to one cell outside the world,
+// to the cell of the world it refers to. It returns false if the neighbour is outside a bounded world.
+// The vertical edge is crossed first, so the corners of the projective plane come out consistently.
+func (t Topology) Resolve(x, y, width, height int) (int, int, bool) {
+	switch t {
+	case Bounded:
+		if x < 0 || y < 0 || x >= width || y >= height {
+			return x, y, false
+		}
+	case Reflect:
+		if x < 0 {
+			x = -1 - x
+		} else if x >= width {
+			x = 2*width - 1 - x
+		}
+		if y < 0 {
+			y = -1 - y
+		} else if y >= height {
+			y = 2*height - 1 - y
+		}
+	case KleinBottle, ProjectivePlane:
+		// Crossing the top or bottom edge mirrors the column
+		if y < 0 {
+			y += height
+			x = width - 1 - x
+		} else if y >= height {
+			y -= height
+			x = width - 1 - x
+		}
+		if t == KleinBottle {
+			x = (x + width) % width
+		} else if x < 0 {
+			// Crossing the left or right edge of the projective plane mirrors the row
+			x += width
+			y = height - 1 - y
+		} else if x >= width {
+			x -= width
+			y = height - 1 - y
+		}
+	default:
+		// Wraparound. Add height and width for negative values
+		x = (x + width) % width
+		y = (y + height) % height
+	}
+	return x, y, true
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+	"uk.ac.bris.cs/gameoflife/web"
+)
+
+// viewerMessage is a message the viewer's page reads from /events
+type viewerMessage struct {
+	Type   string
+	Turn   int
+	Width  int
+	Height int
+	Cells  []int
+	Count  int
+	State  string
+	Text   string
+}
+
+// viewerSocket is the page's end of the WebSocket to /events
+type viewerSocket struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Connects to the events of a viewer from its own page, with the key from the example in RFC 6455
+func dialViewer(t *testing.T, address string) *viewerSocket {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(20 * time.Second))
+	fmt.Fprintf(conn, "GET /events HTTP/1.1\r\nHost: %v\r\nOrigin: http://%v\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", address, address)
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("expected the handshake to be accepted, got %v %v", response.Status, response.Header)
+	}
+	return &viewerSocket{conn: conn, reader: reader}
+}
+
+// Reads a frame from the server, which isn't masked
+func (v *viewerSocket) readFrame() (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(v.reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(v.reader, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(v.reader, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	payload := make([]byte, length)
+	_, err := io.ReadFull(v.reader, payload)
+	return header[0] & 0x0F, payload, err
+}
+
+// Reads the next message, returning nil once the server closes the WebSocket
+func (v *viewerSocket) read(t *testing.T) *viewerMessage {
+	opcode, payload, err := v.readFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opcode == 0x8 {
+		return nil
+	}
+	var m viewerMessage
+	if err := json.Unmarshal(payload, &m); err != nil {
+		t.Fatal(err)
+	}
+	return &m
+}
+
+// Sends a key as a masked text frame, as a browser has to
+func (v *viewerSocket) send(t *testing.T, key string) {
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame := append([]byte{0x81, 0x80 | byte(len(key))}, mask...)
+	for i := range key {
+		frame = append(frame, key[i]^mask[i%4])
+	}
+	if _, err := v.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Reads messages until one of a type, returning nil if the WebSocket is closed first
+func (v *viewerSocket) readUntil(t *testing.T, messageType string) *viewerMessage {
+	for {
+		m := v.read(t)
+		if m == nil || m.Type == messageType {
+			return m
+		}
+	}
+}
+
+// Serves a run to browsers on a free port, holding back its events until a viewer has connected and been sent
+// the world so that it sees every turn. Returns the viewer, the world and a channel closed once the run has finished.
+func serveRun(t *testing.T, p gol.Params) (*web.Server, *viewerSocket, *viewerMessage, chan struct{}) {
+	server, err := web.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan gol.Event, 1000)
+	held := make(chan gol.Event, 1000)
+	connected := make(chan struct{})
+	keyPresses := make(chan rune, 10)
+	done := make(chan struct{})
+	go func() {
+		<-connected
+		for event := range held {
+			events <- event
+		}
+		close(events)
+	}()
+	go func() {
+		server.Run(p, events, keyPresses)
+		// Let the run finish after the final turn, as main does
+		for range events {
+		}
+		close(done)
+	}()
+	go gol.Run(p, held, keyPresses)
+
+	viewer := dialViewer(t, server.Addr().String())
+	world := viewer.read(t)
+	close(connected)
+	if world == nil || world.Type != "world" || world.Width != p.ImageWidth || world.Height != p.ImageHeight {
+		t.Fatalf("expected the whole %vx%v world first, got %+v", p.ImageWidth, p.ImageHeight, world)
+	}
+	return server, viewer, world, done
+}
+
+// TestWeb serves runs to a WebSocket client that plays the part of the viewer's page. The world it builds up from
+// the messages should be the final turn, and the keys it sends should pause and quit the run like SDL's.
+func TestWeb(t *testing.T) {
+	t.Run("world", func(t *testing.T) {
+		p := gol.Params{Turns: 100, Threads: 8, ImageWidth: 64, ImageHeight: 64}
+		_, viewer, first, done := serveRun(t, p)
+		defer viewer.conn.Close()
+
+		world := make(map[util.Cell]bool)
+		flip := func(cells []int) {
+			for i := 0; i < len(cells); i += 2 {
+				cell := util.Cell{X: cells[i], Y: cells[i+1]}
+				world[cell] = !world[cell]
+			}
+		}
+		flip(first.Cells)
+		var final *viewerMessage
+		for final == nil {
+			m := viewer.read(t)
+			if m == nil {
+				t.Fatal("expected a final message before the WebSocket was closed")
+			}
+			switch m.Type {
+			case "turn":
+				flip(m.Cells)
+			case "final":
+				final = m
+			}
+		}
+		if final.Turn != 100 {
+			t.Errorf("expected the final turn to be 100, got %v", final.Turn)
+		}
+		var alive []util.Cell
+		for cell, isAlive := range world {
+			if isAlive {
+				alive = append(alive, cell)
+			}
+		}
+		assertEqualBoard(t, alive, readAliveCells("check/images/64x64x100.pgm", 64, 64), p)
+		if m := viewer.read(t); m != nil {
+			t.Errorf("expected the WebSocket to be closed after the final message, got %+v", m)
+		}
+		<-done
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		p := gol.Params{Turns: 1000000000, Threads: 8, ImageWidth: 64, ImageHeight: 64}
+		server, viewer, _, done := serveRun(t, p)
+		defer viewer.conn.Close()
+		address := server.Addr().String()
+
+		response, err := http.Get("http://" + address + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if !strings.Contains(string(body), "<canvas") {
+			t.Error("expected the page to have a canvas")
+		}
+		response, err = http.Get("http://" + address + "/events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected /events without a handshake to be a bad request, got %v", response.Status)
+		}
+		// A page on another site opening the WebSocket, which could send keys to the run
+		request, err := http.NewRequest("GET", "http://"+address+"/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Connection", "Upgrade")
+		request.Header.Set("Upgrade", "websocket")
+		request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		request.Header.Set("Sec-WebSocket-Version", "13")
+		request.Header.Set("Origin", "http://example.com")
+		response, err = http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusForbidden {
+			t.Errorf("expected a handshake from another origin to be forbidden, got %v", response.Status)
+		}
+
+		for _, state := range []string{"Paused", "Executing"} {
+			viewer.send(t, "p")
+			if m := viewer.readUntil(t, "state"); m == nil || m.State != state {
+				t.Fatalf("expected p to change the state to %v, got %+v", state, m)
+			}
+		}
+		viewer.send(t, "q")
+		if m := viewer.readUntil(t, "final"); m == nil {
+			t.Fatal("expected q to finish the run")
+		}
+		<-done
+	})
+}